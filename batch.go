@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tombryson/TradingViewAPI_serivce/pkg/store"
+)
+
+const (
+	defaultBatchFlushInterval = 50 * time.Millisecond
+	defaultBatchMaxPending    = 200
+)
+
+// indicatorReadingKey identifies one ticker/indicator pair in
+// pendingIndicatorReadings.
+type indicatorReadingKey struct {
+	ticker    string
+	indicator string
+}
+
+// batchingStore wraps a store.Store and coalesces its highest-volume
+// writes, UpsertSignal, AppendHistory, UpsertIndicatorReading and
+// SetCompositeSignal: all four are buffered in memory and flushed to the
+// underlying store (via BatchUpsertSignals, BatchAppendHistory,
+// BatchUpsertIndicatorReadings and BatchSetCompositeSignals respectively)
+// once flushInterval has elapsed or any one of the four buffers holds
+// maxPending entries, whichever comes first. This trades a small, bounded delay before a write
+// is durable for far fewer write transactions during a TradingView alert
+// storm. Signal, indicator reading and composite signal reads are served
+// from the buffer first so callers never observe state going backwards;
+// history reads still go straight to the underlying store, so a row can
+// take up to one flush cycle to appear in /history.
+type batchingStore struct {
+	store.Store
+
+	flushInterval time.Duration
+	maxPending    int
+
+	mu                       sync.Mutex
+	pendingSignals           map[string]store.Signal
+	pendingHistory           []store.HistoryEntry
+	pendingIndicatorReadings map[indicatorReadingKey]int
+	pendingComposite         map[string]string
+	done                     chan struct{}
+}
+
+// newBatchingStore wraps s with the given flush policy and starts its
+// background flush loop. Callers must call Close to stop the loop and
+// flush anything still buffered.
+func newBatchingStore(s store.Store, flushInterval time.Duration, maxPending int) *batchingStore {
+	b := &batchingStore{
+		Store:                    s,
+		flushInterval:            flushInterval,
+		maxPending:               maxPending,
+		pendingSignals:           make(map[string]store.Signal),
+		pendingIndicatorReadings: make(map[indicatorReadingKey]int),
+		pendingComposite:         make(map[string]string),
+		done:                     make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// UpsertSignal buffers sig for the next flush instead of writing it
+// immediately, overwriting any pending write already queued for the same
+// ticker so only its latest state is persisted.
+func (b *batchingStore) UpsertSignal(ctx context.Context, sig store.Signal) error {
+	b.mu.Lock()
+	b.pendingSignals[sig.Ticker] = sig
+	full := len(b.pendingSignals) >= b.maxPending
+	b.mu.Unlock()
+
+	if full {
+		b.flush()
+	}
+	return nil
+}
+
+// AppendHistory buffers entry for the next flush instead of writing it
+// immediately. Unlike UpsertSignal, every buffered entry is kept (not just
+// the latest per ticker), since signal_history never overwrites.
+func (b *batchingStore) AppendHistory(ctx context.Context, entry store.HistoryEntry) error {
+	b.mu.Lock()
+	b.pendingHistory = append(b.pendingHistory, entry)
+	full := len(b.pendingHistory) >= b.maxPending
+	b.mu.Unlock()
+
+	if full {
+		b.flush()
+	}
+	return nil
+}
+
+// GetCurrentSignal checks the pending buffer before falling through to the
+// underlying store, so a signal just upserted is visible even before it's
+// flushed.
+func (b *batchingStore) GetCurrentSignal(ctx context.Context, ticker string) (store.Signal, error) {
+	b.mu.Lock()
+	sig, buffered := b.pendingSignals[ticker]
+	b.mu.Unlock()
+	if buffered {
+		return sig, nil
+	}
+	return b.Store.GetCurrentSignal(ctx, ticker)
+}
+
+// ListSecurities overlays pending buffered signal and composite signal
+// writes onto the underlying store's rows, so a just-upserted ticker's
+// latest state is reflected even before it's flushed.
+func (b *batchingStore) ListSecurities(ctx context.Context) ([]store.Signal, error) {
+	securities, err := b.Store.ListSecurities(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.pendingSignals) == 0 && len(b.pendingComposite) == 0 {
+		return securities, nil
+	}
+
+	merged := make(map[string]store.Signal, len(securities)+len(b.pendingSignals)+len(b.pendingComposite))
+	for _, sig := range securities {
+		merged[sig.Ticker] = sig
+	}
+	for ticker, sig := range b.pendingSignals {
+		// UpsertSignal never writes composite_signal, so keep the stored
+		// one; the buffered Signal has no DateUpdated yet, so keep that too.
+		if existing, ok := merged[ticker]; ok {
+			sig.CompositeSignal = existing.CompositeSignal
+			sig.DateUpdated = existing.DateUpdated
+		}
+		merged[ticker] = sig
+	}
+	for ticker, compositeSignal := range b.pendingComposite {
+		sig := merged[ticker]
+		sig.Ticker = ticker
+		sig.CompositeSignal = compositeSignal
+		merged[ticker] = sig
+	}
+
+	result := make([]store.Signal, 0, len(merged))
+	for _, sig := range merged {
+		result = append(result, sig)
+	}
+	return result, nil
+}
+
+// UpsertIndicatorReading buffers value for the next flush instead of
+// writing it immediately, overwriting any pending reading already queued
+// for the same ticker/indicator pair so only its latest value is
+// persisted.
+func (b *batchingStore) UpsertIndicatorReading(ctx context.Context, ticker, indicator string, value int) error {
+	b.mu.Lock()
+	b.pendingIndicatorReadings[indicatorReadingKey{ticker, indicator}] = value
+	full := len(b.pendingIndicatorReadings) >= b.maxPending
+	b.mu.Unlock()
+
+	if full {
+		b.flush()
+	}
+	return nil
+}
+
+// IndicatorReadings overlays pending buffered readings onto the underlying
+// store's readings for ticker, so a reading just upserted is visible even
+// before it's flushed. This matters because handleWebhook reads it back
+// within the same per-ticker lock it upserted under, to re-run the
+// composite signals engine.
+func (b *batchingStore) IndicatorReadings(ctx context.Context, ticker string) (map[string]int, error) {
+	readings, err := b.Store.IndicatorReadings(ctx, ticker)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.pendingIndicatorReadings) == 0 {
+		return readings, nil
+	}
+
+	merged := make(map[string]int, len(readings))
+	for indicator, value := range readings {
+		merged[indicator] = value
+	}
+	for key, value := range b.pendingIndicatorReadings {
+		if key.ticker == ticker {
+			merged[key.indicator] = value
+		}
+	}
+	return merged, nil
+}
+
+// SetCompositeSignal buffers compositeSignal for the next flush instead of
+// writing it immediately, overwriting any pending write already queued for
+// the same ticker so only its latest decision is persisted.
+func (b *batchingStore) SetCompositeSignal(ctx context.Context, ticker, compositeSignal string) error {
+	b.mu.Lock()
+	b.pendingComposite[ticker] = compositeSignal
+	full := len(b.pendingComposite) >= b.maxPending
+	b.mu.Unlock()
+
+	if full {
+		b.flush()
+	}
+	return nil
+}
+
+func (b *batchingStore) run() {
+	ticker := time.NewTicker(b.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.flush()
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// flush writes every currently buffered signal, history entry, indicator
+// reading and composite signal to the underlying store, each in its own
+// batch, and clears all four buffers, regardless of why it was triggered.
+func (b *batchingStore) flush() {
+	b.mu.Lock()
+	if len(b.pendingSignals) == 0 && len(b.pendingHistory) == 0 &&
+		len(b.pendingIndicatorReadings) == 0 && len(b.pendingComposite) == 0 {
+		b.mu.Unlock()
+		return
+	}
+
+	signalBatch := make([]store.Signal, 0, len(b.pendingSignals))
+	for _, sig := range b.pendingSignals {
+		signalBatch = append(signalBatch, sig)
+	}
+	b.pendingSignals = make(map[string]store.Signal)
+
+	historyBatch := b.pendingHistory
+	b.pendingHistory = nil
+
+	readingBatch := make([]store.IndicatorReading, 0, len(b.pendingIndicatorReadings))
+	for key, value := range b.pendingIndicatorReadings {
+		readingBatch = append(readingBatch, store.IndicatorReading{Ticker: key.ticker, Indicator: key.indicator, Value: value})
+	}
+	b.pendingIndicatorReadings = make(map[indicatorReadingKey]int)
+
+	compositeBatch := make([]store.CompositeSignalUpdate, 0, len(b.pendingComposite))
+	for ticker, compositeSignal := range b.pendingComposite {
+		compositeBatch = append(compositeBatch, store.CompositeSignalUpdate{Ticker: ticker, CompositeSignal: compositeSignal})
+	}
+	b.pendingComposite = make(map[string]string)
+	b.mu.Unlock()
+
+	if len(signalBatch) > 0 {
+		if err := b.Store.BatchUpsertSignals(context.Background(), signalBatch); err != nil {
+			slog.Error("failed to flush batched signal writes", "count", len(signalBatch), "error", err)
+		}
+	}
+	if len(historyBatch) > 0 {
+		if err := b.Store.BatchAppendHistory(context.Background(), historyBatch); err != nil {
+			slog.Error("failed to flush batched history writes", "count", len(historyBatch), "error", err)
+		}
+	}
+	if len(readingBatch) > 0 {
+		if err := b.Store.BatchUpsertIndicatorReadings(context.Background(), readingBatch); err != nil {
+			slog.Error("failed to flush batched indicator reading writes", "count", len(readingBatch), "error", err)
+		}
+	}
+	if len(compositeBatch) > 0 {
+		if err := b.Store.BatchSetCompositeSignals(context.Background(), compositeBatch); err != nil {
+			slog.Error("failed to flush batched composite signal writes", "count", len(compositeBatch), "error", err)
+		}
+	}
+}
+
+// Close stops the flush loop, flushes anything still buffered, and closes
+// the underlying store.
+func (b *batchingStore) Close() error {
+	close(b.done)
+	b.flush()
+	return b.Store.Close()
+}
+
+// batchFlushIntervalFromEnv reads WEBHOOK_BATCH_FLUSH_INTERVAL_MS, falling
+// back to defaultBatchFlushInterval if it's unset or not a positive number
+// of milliseconds.
+func batchFlushIntervalFromEnv() time.Duration {
+	raw := os.Getenv("WEBHOOK_BATCH_FLUSH_INTERVAL_MS")
+	if raw == "" {
+		return defaultBatchFlushInterval
+	}
+	ms, err := strconv.Atoi(raw)
+	if err != nil || ms <= 0 {
+		return defaultBatchFlushInterval
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// batchMaxPendingFromEnv reads WEBHOOK_BATCH_MAX_PENDING, falling back to
+// defaultBatchMaxPending if it's unset or not a positive number.
+func batchMaxPendingFromEnv() int {
+	raw := os.Getenv("WEBHOOK_BATCH_MAX_PENDING")
+	if raw == "" {
+		return defaultBatchMaxPending
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		return defaultBatchMaxPending
+	}
+	return n
+}
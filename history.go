@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tombryson/TradingViewAPI_serivce/pkg/store"
+)
+
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+// historyResponse is the JSON shape returned by GET /history.
+type historyResponse struct {
+	Entries    []store.HistoryEntry `json:"entries"`
+	NextCursor int64                `json:"nextCursor,omitempty"`
+}
+
+// parseHistoryFilter builds a store.HistoryFilter from /history's query
+// parameters, defaulting and capping Limit.
+func parseHistoryFilter(r *http.Request) (store.HistoryFilter, error) {
+	q := r.URL.Query()
+
+	f := store.HistoryFilter{
+		Ticker:    q.Get("ticker"),
+		Indicator: q.Get("indicator"),
+		Limit:     defaultHistoryLimit,
+	}
+
+	if raw := q.Get("from"); raw != "" {
+		from, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return f, fmt.Errorf("invalid from: %w", err)
+		}
+		f.From = &from
+	}
+	if raw := q.Get("to"); raw != "" {
+		to, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return f, fmt.Errorf("invalid to: %w", err)
+		}
+		f.To = &to
+	}
+	if raw := q.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			return f, fmt.Errorf("invalid limit: %q", raw)
+		}
+		if limit > maxHistoryLimit {
+			limit = maxHistoryLimit
+		}
+		f.Limit = limit
+	}
+	if raw := q.Get("cursor"); raw != "" {
+		cursor, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return f, fmt.Errorf("invalid cursor: %q", raw)
+		}
+		f.Cursor = cursor
+	}
+
+	return f, nil
+}
+
+// handleHistory serves GET /history?ticker=...&from=...&to=...&indicator=...,
+// returning the matching signal_history rows as JSON by default or as CSV
+// when the client sends Accept: text/csv.
+func handleHistory(s store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := requestIDFromContext(r.Context())
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		f, err := parseHistoryFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if f.Ticker == "" {
+			http.Error(w, "Missing ticker query parameter", http.StatusBadRequest)
+			return
+		}
+
+		entries, nextCursor, err := s.ListHistory(r.Context(), f)
+		if err != nil {
+			slog.Error("error querying signal history", "request_id", reqID, "ticker", f.Ticker, "error", err)
+			http.Error(w, "Error querying database", http.StatusInternalServerError)
+			return
+		}
+
+		if r.Header.Get("Accept") == "text/csv" {
+			writeHistoryCSV(w, entries)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(historyResponse{Entries: entries, NextCursor: nextCursor}); err != nil {
+			slog.Error("error encoding JSON", "request_id", reqID, "ticker", f.Ticker, "error", err)
+			http.Error(w, "Error encoding JSON", http.StatusInternalServerError)
+		}
+	}
+}
+
+// writeHistoryCSV renders entries as text/csv with a header row.
+func writeHistoryCSV(w http.ResponseWriter, entries []store.HistoryEntry) {
+	w.Header().Set("Content-Type", "text/csv")
+	cw := csv.NewWriter(w)
+	defer cw.Flush()
+
+	cw.Write([]string{"ticker", "indicator", "signal", "signal_strength", "vwma_position", "analyst_price_target", "received_at"})
+	for _, e := range entries {
+		priceTarget := ""
+		if e.AnalystPriceTarget != nil {
+			priceTarget = strconv.FormatFloat(*e.AnalystPriceTarget, 'f', -1, 64)
+		}
+		cw.Write([]string{
+			e.Ticker,
+			e.Indicator,
+			e.Signal,
+			strconv.Itoa(e.SignalStrength),
+			e.VWMAPosition,
+			priceTarget,
+			e.ReceivedAt.Format(time.RFC3339),
+		})
+	}
+}
+
+// handleHistoryStats serves GET /history/stats?ticker=..., returning
+// per-indicator win/loss counts and average holding time computed from
+// signal_history.
+func handleHistoryStats(s store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := requestIDFromContext(r.Context())
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ticker := r.URL.Query().Get("ticker")
+		if ticker == "" {
+			http.Error(w, "Missing ticker query parameter", http.StatusBadRequest)
+			return
+		}
+
+		stats, err := s.HistoryStats(r.Context(), ticker)
+		if err != nil {
+			slog.Error("error computing history stats", "request_id", reqID, "ticker", ticker, "error", err)
+			http.Error(w, "Error querying database", http.StatusInternalServerError)
+			return
+		}
+
+		result := make([]map[string]interface{}, 0, len(stats))
+		for _, stat := range stats {
+			result = append(result, map[string]interface{}{
+				"indicator":        stat.Indicator,
+				"wins":             stat.Wins,
+				"losses":           stat.Losses,
+				"avgHoldingTimeMs": stat.AvgHoldingTime.Milliseconds(),
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			slog.Error("error encoding JSON", "request_id", reqID, "ticker", ticker, "error", err)
+			http.Error(w, "Error encoding JSON", http.StatusInternalServerError)
+		}
+	}
+}
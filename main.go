@@ -1,16 +1,78 @@
 package main
 
 import (
-	"database/sql"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
+	"os"
+	"strconv"
+	"sync"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/tombryson/TradingViewAPI_serivce/pkg/signals"
+	"github.com/tombryson/TradingViewAPI_serivce/pkg/store"
 )
 
+// defaultReplayWindow is how old an incoming webhook's timestamp is allowed
+// to be before it's rejected as a possible replay.
+const defaultReplayWindow = 60 * time.Second
+
+// verifyWebhookSignature checks the X-Signature/X-Timestamp headers on an
+// incoming webhook request against WEBHOOK_SECRET, mirroring the
+// hex(HMAC_SHA256(secret, timestamp+body)) scheme used by exchange API
+// clients like Bybit's. The comparison is constant-time and requests whose
+// timestamp falls outside the replay window (default 60s, overridable via
+// WEBHOOK_REPLAY_WINDOW_SECONDS) are rejected.
+func verifyWebhookSignature(r *http.Request, body []byte) error {
+	secret := os.Getenv("WEBHOOK_SECRET")
+	if secret == "" {
+		return fmt.Errorf("WEBHOOK_SECRET not configured")
+	}
+
+	signature := r.Header.Get("X-Signature")
+	timestamp := r.Header.Get("X-Timestamp")
+	if signature == "" || timestamp == "" {
+		return fmt.Errorf("missing X-Signature or X-Timestamp header")
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid X-Timestamp: %w", err)
+	}
+
+	window := defaultReplayWindow
+	if raw := os.Getenv("WEBHOOK_REPLAY_WINDOW_SECONDS"); raw != "" {
+		if seconds, err := strconv.Atoi(raw); err == nil {
+			window = time.Duration(seconds) * time.Second
+		}
+	}
+
+	age := time.Since(time.Unix(ts, 0))
+	if age < 0 {
+		age = -age
+	}
+	if age > window {
+		return fmt.Errorf("timestamp %s outside allowed window of %s", timestamp, window)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + string(body)))
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
 // NullableFloat64 is a custom type to handle flexible JSON parsing for float64
 type NullableFloat64 struct {
 	*float64
@@ -23,7 +85,7 @@ func (nf *NullableFloat64) UnmarshalJSON(data []byte) error {
 	}
 	var val float64
 	if err := json.Unmarshal(data, &val); err != nil {
-		log.Printf("Invalid analystPriceTarget value %s, treating as null: %v", string(data), err)
+		slog.Warn("invalid analystPriceTarget value, treating as null", "value", string(data), "error", err)
 		nf.float64 = nil
 		return nil
 	}
@@ -31,225 +93,311 @@ func (nf *NullableFloat64) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// MarshalJSON emits null for a nil value and the plain number otherwise, so
+// a TradingViewAlert re-marshaled for /stream round-trips an absent price
+// target instead of degrading it into "{}".
+func (nf NullableFloat64) MarshalJSON() ([]byte, error) {
+	if nf.float64 == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(*nf.float64)
+}
+
 // TradingViewAlert represents the JSON structure from TradingView alerts
 type TradingViewAlert struct {
-	Ticker             string         `json:"ticker"`
-	Signal             string         `json:"signal,omitempty"`
-	Event              string         `json:"event,omitempty"`
-	SignalStrength     int            `json:"signalStrength"`
-	VWMAPosition       string         `json:"vwmaPosition"`
+	Ticker             string          `json:"ticker"`
+	Signal             string          `json:"signal,omitempty"`
+	Event              string          `json:"event,omitempty"`
+	SignalStrength     int             `json:"signalStrength"`
+	VWMAPosition       string          `json:"vwmaPosition"`
 	AnalystPriceTarget NullableFloat64 `json:"analystPriceTarget"`
+	Indicator          string          `json:"indicator,omitempty"`
+	IndicatorValue     int             `json:"indicatorValue,omitempty"`
 }
 
-func initDB() *sql.DB {
-	db, err := sql.Open("sqlite3", "/data/stockmomentum.db")
-	if err != nil {
-		log.Fatalf("Failed to open database: %v", err)
+// indicatorValueToSignal maps the 0/1/2 sell/neutral/buy scale TradingView
+// sends for individual indicators onto the same "buy"/"sell"/"neutral"
+// vocabulary used elsewhere, so signal_history reads consistently across
+// alert types.
+func indicatorValueToSignal(value int) string {
+	switch {
+	case value <= 0:
+		return "sell"
+	case value == 1:
+		return "neutral"
+	default:
+		return "buy"
 	}
+}
 
-	// Create the full securities table with all columns
-	query := `
-	CREATE TABLE IF NOT EXISTS securities (
-		ticker TEXT PRIMARY KEY,
-		signal TEXT,
-		signal_strength INTEGER DEFAULT 0,
-		vwma_position TEXT DEFAULT '',
-		analyst_price_target REAL,
-		date_updated DATETIME DEFAULT CURRENT_TIMESTAMP,
-		signal_date DATETIME
-	);`
-	_, err = db.Exec(query)
-	if err != nil {
-		log.Fatalf("Error creating securities table: %v", err)
+// loadSignalsEngine builds the composite signals engine from the YAML rule
+// file at SIGNALS_RULES_PATH, falling back to DefaultRuleSet if the
+// variable isn't set.
+func loadSignalsEngine() *signals.Engine {
+	path := os.Getenv("SIGNALS_RULES_PATH")
+	if path == "" {
+		return signals.NewEngine(signals.DefaultRuleSet())
 	}
 
-	// Verify table structure
-	rows, err := db.Query("PRAGMA table_info(securities);")
+	rules, err := signals.LoadRuleSet(path)
 	if err != nil {
-		log.Fatalf("Error querying table info: %v", err)
-	}
-	defer rows.Close()
-
-	expectedColumns := []string{
-		"ticker",
-		"signal",
-		"signal_strength",
-		"vwma_position",
-		"analyst_price_target",
-		"date_updated",
-		"signal_date",
-	}
-	foundColumns := make([]string, 0)
-	for rows.Next() {
-		var cid int
-		var name, typeStr string
-		var notnull, pk int
-		var dflt_value sql.NullString
-		if err := rows.Scan(&cid, &name, &typeStr, &notnull, &dflt_value, &pk); err != nil {
-			log.Printf("Error scanning table info: %v", err)
-			continue
-		}
-		foundColumns = append(foundColumns, name)
-		log.Printf("Found column %s: %s", name, typeStr)
+		slog.Error("failed to load signals rule file", "path", path, "error", err)
+		os.Exit(1)
 	}
+	return signals.NewEngine(rules)
+}
 
-	// Validate schema
-	if len(foundColumns) != len(expectedColumns) {
-		log.Fatalf("Schema mismatch: expected %d columns (%v), found %d columns (%v)",
-			len(expectedColumns), expectedColumns, len(foundColumns), foundColumns)
-	}
-	for i, col := range expectedColumns {
-		if i >= len(foundColumns) || foundColumns[i] != col {
-			log.Fatalf("Schema mismatch: expected column %s at position %d, found %s",
-				col, i, foundColumns[i])
-		}
+// tickerMutex hands out a per-ticker lock, created lazily on first use, so
+// callers can serialize a read-modify-write sequence keyed by ticker
+// without blocking unrelated tickers against each other.
+type tickerMutex struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func newTickerMutex() *tickerMutex {
+	return &tickerMutex{locks: make(map[string]*sync.Mutex)}
+}
+
+// lock acquires the lock for ticker and returns a func to release it.
+func (t *tickerMutex) lock(ticker string) func() {
+	t.mu.Lock()
+	l, ok := t.locks[ticker]
+	if !ok {
+		l = &sync.Mutex{}
+		t.locks[ticker] = l
 	}
+	t.mu.Unlock()
 
-	return db
+	l.Lock()
+	return l.Unlock
 }
 
 // handleWebhook handles GET and POST methods
-func handleWebhook(db *sql.DB) http.HandlerFunc {
+func handleWebhook(s store.Store, b *broker, engine *signals.Engine, tickerLimiter *keyedLimiter) http.HandlerFunc {
+	compositeLocks := newTickerMutex()
+
 	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := requestIDFromContext(r.Context())
+
 		switch r.Method {
 		case http.MethodGet:
-			rows, err := db.Query("SELECT ticker, signal, signal_strength, vwma_position, analyst_price_target, date_updated, signal_date FROM securities")
+			securities, err := s.ListSecurities(r.Context())
 			if err != nil {
-				log.Printf("Error querying database: %v", err)
+				slog.Error("error querying database", "request_id", reqID, "error", err)
 				http.Error(w, "Error querying database", http.StatusInternalServerError)
 				return
 			}
-			defer rows.Close()
 
 			var result []map[string]interface{}
-			for rows.Next() {
-				var ticker, signal, vwmaPosition string
-				var signalStrength int
-				var priceTarget sql.NullFloat64
-				var dateUpdated, signalDate sql.NullTime
-				err := rows.Scan(&ticker, &signal, &signalStrength, &vwmaPosition, &priceTarget, &dateUpdated, &signalDate)
-				if err != nil {
-					log.Printf("Error scanning row for ticker %s: %v (skipping row)", ticker, err)
-					continue // Skip problematic row and continue with next
-				}
+			for _, sec := range securities {
 				m := map[string]interface{}{
-					"ticker":               ticker,
-					"signal":               signal,
-					"signalStrength":       signalStrength,
-					"vwmaPosition":         vwmaPosition,
+					"ticker":               sec.Ticker,
+					"signal":               sec.Signal,
+					"signalStrength":       sec.SignalStrength,
+					"vwmaPosition":         sec.VWMAPosition,
 					"analyst_price_target": nil,
 					"date_updated":         nil,
 					"signalDate":           nil,
+					"compositeSignal":      sec.CompositeSignal,
 				}
-				if priceTarget.Valid {
-					m["analyst_price_target"] = priceTarget.Float64
+				if sec.AnalystPriceTarget != nil {
+					m["analyst_price_target"] = *sec.AnalystPriceTarget
 				}
-				if dateUpdated.Valid {
-					m["date_updated"] = dateUpdated.Time.Format(time.RFC3339)
+				if !sec.DateUpdated.IsZero() {
+					m["date_updated"] = sec.DateUpdated.Format(time.RFC3339)
 				}
-				if signalDate.Valid {
-					m["signalDate"] = signalDate.Time.Format(time.RFC3339)
+				if sec.SignalDate != nil {
+					m["signalDate"] = sec.SignalDate.Format(time.RFC3339)
 				}
 				result = append(result, m)
 			}
 
 			w.Header().Set("Content-Type", "application/json")
 			if err := json.NewEncoder(w).Encode(result); err != nil {
-				log.Printf("Error encoding JSON: %v", err)
+				slog.Error("error encoding JSON", "request_id", reqID, "error", err)
 				http.Error(w, "Error encoding JSON", http.StatusInternalServerError)
 				return
 			}
 
 		case http.MethodPost:
+			start := time.Now()
+			outcome := "ok"
+			defer func() {
+				webhookRequestsTotal.WithLabelValues(outcome).Inc()
+				webhookHandlerDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+			}()
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				outcome = "bad_payload"
+				slog.Error("error reading request body", "request_id", reqID, "error", err)
+				http.Error(w, "Error reading request body", http.StatusBadRequest)
+				return
+			}
+
+			if err := verifyWebhookSignature(r, body); err != nil {
+				outcome = "bad_payload"
+				slog.Warn("webhook authentication failed", "request_id", reqID, "error", err)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
 			var alert TradingViewAlert
-			if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
-				log.Printf("JSON decoding error: %v", err)
+			if err := json.Unmarshal(body, &alert); err != nil {
+				outcome = "bad_payload"
+				slog.Error("JSON decoding error", "request_id", reqID, "error", err)
 				http.Error(w, "Invalid payload", http.StatusBadRequest)
 				return
 			}
-			log.Printf("Received alert: %+v", alert)
+			slog.Info("received alert", "request_id", reqID, "ticker", alert.Ticker, "indicator", alert.Indicator, "signal", alert.Signal)
 
 			// Validate required fields
 			if alert.Ticker == "" {
+				outcome = "bad_payload"
 				http.Error(w, "Missing ticker", http.StatusBadRequest)
 				return
 			}
 
-			// Convert NullableFloat64 to sql.NullFloat64
-			var priceTarget sql.NullFloat64
+			if ok, retryAfter := tickerLimiter.allow(alert.Ticker); !ok {
+				outcome = "rate_limited"
+				slog.Warn("webhook ticker rate limited", "request_id", reqID, "ticker", alert.Ticker)
+				tooManyRequests(w, retryAfter)
+				return
+			}
+
+			var priceTarget *float64
 			if alert.AnalystPriceTarget.float64 != nil {
-				priceTarget.Float64 = *alert.AnalystPriceTarget.float64
-				priceTarget.Valid = true
+				priceTarget = alert.AnalystPriceTarget.float64
 			}
 
-			if alert.Event == "price_target_change" || alert.Signal == "" {
-				// Handle VWMA-only or price target change update
-				query := `
-				INSERT INTO securities (ticker, signal_strength, vwma_position, analyst_price_target, date_updated)
-				VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
-				ON CONFLICT(ticker) DO UPDATE SET
-					signal_strength = excluded.signal_strength,
-					vwma_position = excluded.vwma_position,
-					analyst_price_target = excluded.analyst_price_target,
-					date_updated = CURRENT_TIMESTAMP;`
-				_, err := db.Exec(query, alert.Ticker, alert.SignalStrength, alert.VWMAPosition, priceTarget)
+			if alert.Indicator != "" {
+				// Handle a per-indicator alert: record the reading, re-run
+				// the composite signals engine over every known reading for
+				// this ticker, and persist the resulting decision. The three
+				// steps are serialized per ticker so two concurrent alerts
+				// for the same ticker can't interleave their
+				// read-evaluate-write and have the slower one overwrite a
+				// newer composite decision with a stale one.
+				defer compositeLocks.lock(alert.Ticker)()
+
+				if err := s.UpsertIndicatorReading(r.Context(), alert.Ticker, alert.Indicator, alert.IndicatorValue); err != nil {
+					outcome = "db_error"
+					slog.Error("failed to record indicator reading", "request_id", reqID, "ticker", alert.Ticker, "indicator", alert.Indicator, "error", err)
+					http.Error(w, fmt.Sprintf("Failed to update database: %v", err), http.StatusInternalServerError)
+					return
+				}
+				indicatorAlertsTotal.WithLabelValues(alert.Indicator).Inc()
+
+				readings, err := s.IndicatorReadings(r.Context(), alert.Ticker)
 				if err != nil {
-					log.Printf("Failed to update database for VWMA/price target alert %+v: %v", alert, err)
+					outcome = "db_error"
+					slog.Error("failed to load indicator readings", "request_id", reqID, "ticker", alert.Ticker, "error", err)
+					http.Error(w, "Error querying database", http.StatusInternalServerError)
+					return
+				}
+
+				decision := engine.Evaluate(alert.Ticker, readings)
+				if err := s.SetCompositeSignal(r.Context(), alert.Ticker, decision.Signal); err != nil {
+					outcome = "db_error"
+					slog.Error("failed to persist composite signal", "request_id", reqID, "ticker", alert.Ticker, "error", err)
+					http.Error(w, fmt.Sprintf("Failed to update database: %v", err), http.StatusInternalServerError)
+					return
+				}
+
+				publishComposite(b, decision)
+
+				historyEntry := store.HistoryEntry{
+					Ticker:             alert.Ticker,
+					Indicator:          alert.Indicator,
+					Signal:             indicatorValueToSignal(alert.IndicatorValue),
+					SignalStrength:     alert.IndicatorValue,
+					AnalystPriceTarget: priceTarget,
+				}
+				if err := s.AppendHistory(r.Context(), historyEntry); err != nil {
+					slog.Error("failed to append signal history", "request_id", reqID, "ticker", alert.Ticker, "error", err)
+				}
+			} else if alert.Event == "price_target_change" || alert.Signal == "" {
+				// Handle VWMA-only or price target change update
+				if err := s.UpsertVWMA(r.Context(), alert.Ticker, alert.SignalStrength, alert.VWMAPosition, priceTarget); err != nil {
+					outcome = "db_error"
+					slog.Error("failed to update database for VWMA/price target alert", "request_id", reqID, "ticker", alert.Ticker, "error", err)
 					http.Error(w, fmt.Sprintf("Failed to update database: %v", err), http.StatusInternalServerError)
 					return
 				}
+
+				historyEntry := store.HistoryEntry{
+					Ticker:             alert.Ticker,
+					Signal:             alert.Signal,
+					SignalStrength:     alert.SignalStrength,
+					VWMAPosition:       alert.VWMAPosition,
+					AnalystPriceTarget: priceTarget,
+				}
+				if err := s.AppendHistory(r.Context(), historyEntry); err != nil {
+					slog.Error("failed to append signal history", "request_id", reqID, "ticker", alert.Ticker, "error", err)
+				}
 			} else {
 				// Handle buy/sell signals
 				if alert.Signal != "buy" && alert.Signal != "sell" {
-					log.Printf("Invalid signal for ticker %s: %s", alert.Ticker, alert.Signal)
+					outcome = "invalid_signal"
+					slog.Warn("invalid signal", "request_id", reqID, "ticker", alert.Ticker, "signal", alert.Signal)
 					http.Error(w, "Invalid signal (must be 'buy' or 'sell')", http.StatusBadRequest)
 					return
 				}
+				signalAlertsTotal.WithLabelValues(alert.Signal).Inc()
 
 				// Get current signal and signal_date from database
-				var currentSignal sql.NullString
-				var existingSignalDate sql.NullTime
-				err := db.QueryRow("SELECT signal, signal_date FROM securities WHERE ticker = ?", alert.Ticker).Scan(&currentSignal, &existingSignalDate)
-				if err != nil && err != sql.ErrNoRows {
-					log.Printf("Error querying current signal and signal_date for ticker %s: %v", alert.Ticker, err)
+				current, err := s.GetCurrentSignal(r.Context(), alert.Ticker)
+				if err != nil && !errors.Is(err, store.ErrNotFound) {
+					outcome = "db_error"
+					slog.Error("error querying current signal and signal_date", "request_id", reqID, "ticker", alert.Ticker, "error", err)
 					http.Error(w, "Error querying database", http.StatusInternalServerError)
 					return
 				}
 
 				// Determine signal_date based on signal change
-				var signalDate interface{}
-				if !currentSignal.Valid || currentSignal.String != alert.Signal {
+				var signalDate *time.Time
+				if current.Signal != alert.Signal {
 					// Signal is new or has changed, set signal_date to now
-					signalDate = time.Now().UTC()
+					now := time.Now().UTC()
+					signalDate = &now
 				} else {
-					// Signal is the same, preserve existing signal_date or set to NULL
-					if existingSignalDate.Valid {
-						signalDate = existingSignalDate.Time
-					} else {
-						signalDate = nil
-					}
+					// Signal is the same, preserve existing signal_date
+					signalDate = current.SignalDate
 				}
 
-				// Update database for buy/sell signals
-				query := `
-				INSERT INTO securities (ticker, signal, signal_strength, vwma_position, analyst_price_target, date_updated, signal_date)
-				VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP, ?)
-				ON CONFLICT(ticker) DO UPDATE SET
-					signal = excluded.signal,
-					signal_strength = excluded.signal_strength,
-					vwma_position = excluded.vwma_position,
-					analyst_price_target = excluded.analyst_price_target,
-					date_updated = CURRENT_TIMESTAMP,
-					signal_date = excluded.signal_date;`
-				_, err = db.Exec(query, alert.Ticker, alert.Signal, alert.SignalStrength, alert.VWMAPosition, priceTarget, signalDate)
-				if err != nil {
-					log.Printf("Failed to update database for alert %+v: %v", alert, err)
+				sig := store.Signal{
+					Ticker:             alert.Ticker,
+					Signal:             alert.Signal,
+					SignalStrength:     alert.SignalStrength,
+					VWMAPosition:       alert.VWMAPosition,
+					AnalystPriceTarget: priceTarget,
+					SignalDate:         signalDate,
+				}
+				if err := s.UpsertSignal(r.Context(), sig); err != nil {
+					outcome = "db_error"
+					slog.Error("failed to update database for alert", "request_id", reqID, "ticker", alert.Ticker, "error", err)
 					http.Error(w, fmt.Sprintf("Failed to update database: %v", err), http.StatusInternalServerError)
 					return
 				}
+
+				historyEntry := store.HistoryEntry{
+					Ticker:             alert.Ticker,
+					Signal:             alert.Signal,
+					SignalStrength:     alert.SignalStrength,
+					VWMAPosition:       alert.VWMAPosition,
+					AnalystPriceTarget: priceTarget,
+				}
+				if err := s.AppendHistory(r.Context(), historyEntry); err != nil {
+					slog.Error("failed to append signal history", "request_id", reqID, "ticker", alert.Ticker, "error", err)
+				}
 			}
 
-			log.Println("Webhook processed successfully")
+			if alert.Indicator == "" {
+				publishAlert(b, alert)
+			}
+
+			slog.Info("webhook processed successfully", "request_id", reqID, "ticker", alert.Ticker, "elapsed_ms", time.Since(start).Milliseconds())
 			w.WriteHeader(http.StatusOK)
 			fmt.Fprint(w, "Webhook processed successfully")
 
@@ -259,24 +407,15 @@ func handleWebhook(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-func deleteTicker(db *sql.DB, ticker string) error {
-	query := `DELETE FROM securities WHERE ticker = ?`
-	_, err := db.Exec(query, ticker)
-	if err != nil {
-		log.Printf("Error deleting ticker %s: %v", ticker, err)
-		return err
-	}
-	return nil
-}
-
-func handleDelete(db *sql.DB) http.HandlerFunc {
+func handleDelete(s store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ticker := r.URL.Query().Get("ticker")
 		if ticker == "" {
 			http.Error(w, "Missing ticker query parameter", http.StatusBadRequest)
 			return
 		}
-		if err := deleteTicker(db, ticker); err != nil {
+		if err := s.Delete(r.Context(), ticker); err != nil {
+			slog.Error("error deleting ticker", "ticker", ticker, "error", err)
 			http.Error(w, fmt.Sprintf("Error deleting ticker %s: %v", ticker, err), http.StatusInternalServerError)
 			return
 		}
@@ -285,13 +424,37 @@ func handleDelete(db *sql.DB) http.HandlerFunc {
 }
 
 func main() {
-	db := initDB()
-	defer db.Close()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
 
-	http.HandleFunc("/webhook", handleWebhook(db))
-	http.HandleFunc("/delete", handleDelete(db))
+	s, err := store.New(os.Getenv("DATABASE_URL"))
+	if err != nil {
+		slog.Error("failed to open store", "error", err)
+		os.Exit(1)
+	}
+	s = newBatchingStore(s, batchFlushIntervalFromEnv(), batchMaxPendingFromEnv())
+	defer s.Close()
+
+	b := newBroker()
+	engine := loadSignalsEngine()
+	registerTrackedTickersGauge(s)
+
+	rateLimit := withWebhookRateLimit(
+		qpsFromEnv("WEBHOOK_RATE_LIMIT_IP_QPS", defaultWebhookIPQPS),
+		trustProxyHeadersFromEnv(),
+	)
+	tickerLimiter := newKeyedLimiter(qpsFromEnv("WEBHOOK_RATE_LIMIT_TICKER_QPS", defaultWebhookTickerQPS))
+
+	http.HandleFunc("/webhook", withRequestLogging(rateLimit(handleWebhook(s, b, engine, tickerLimiter))))
+	http.HandleFunc("/delete", withRequestLogging(handleDelete(s)))
+	http.HandleFunc("/stream", handleStream(s, b))
+	http.HandleFunc("/history", withRequestLogging(handleHistory(s)))
+	http.HandleFunc("/history/stats", withRequestLogging(handleHistoryStats(s)))
+	http.Handle("/metrics", promhttp.Handler())
 
 	port := "8090"
-	log.Printf("Server started and listening on :%s", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
-}
\ No newline at end of file
+	slog.Info("server started", "port", port)
+	if err := http.ListenAndServe(":"+port, nil); err != nil {
+		slog.Error("server exited", "error", err)
+		os.Exit(1)
+	}
+}
@@ -2,141 +2,804 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/tombryson/TradingViewAPI_serivce/pkg/signals"
+	"github.com/tombryson/TradingViewAPI_serivce/pkg/store"
 )
 
-// We want to override the real updateGoogleSheet function during tests.
-// In main.go, add a package-level variable:
-//   var updateGoogleSheetFn = updateGoogleSheet
-// and change handleWebhook so that it calls updateGoogleSheetFn instead of updateGoogleSheet.
-// (If you haven’t done this yet, update main.go accordingly.)
-//
-// For the tests, we override that variable with a dummy function:
-func dummyUpdateGoogleSheet(db *sql.DB, ticker string) error {
-	// In tests, we simply log or do nothing.
-	return nil
+// securitiesTestStore opens a Store backed by a temporary SQLite database
+// (migrated the same way store.New does), for exercising handleWebhook
+// end-to-end.
+func securitiesTestStore(t *testing.T) store.Store {
+	dbPath := filepath.Join(t.TempDir(), "securities.db")
+	s, err := store.New(dbPath)
+	if err != nil {
+		t.Fatalf("Error opening test store: %v", err)
+	}
+
+	t.Cleanup(func() { s.Close() })
+
+	return s
 }
 
-// testDB creates a temporary SQLite database for testing.
-func testDB(t *testing.T) *sql.DB {
-	tmpDB := "test_stockmomentum.db"
-	db, err := sql.Open("sqlite3", tmpDB)
+// signWebhookRequest signs body the same way a TradingView-facing client
+// would, for use in tests.
+func signWebhookRequest(req *http.Request, secret string, timestamp string, body []byte) {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + string(body)))
+	req.Header.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+	req.Header.Set("X-Timestamp", timestamp)
+}
+
+// TestNullableFloat64MarshalJSON asserts that a nil NullableFloat64 marshals
+// to null rather than "{}", since that's what gets broadcast to /stream
+// subscribers whenever an alert omits a price target.
+func TestNullableFloat64MarshalJSON(t *testing.T) {
+	nilJSON, err := json.Marshal(NullableFloat64{})
+	if err != nil {
+		t.Fatalf("Marshal(nil) failed: %v", err)
+	}
+	if string(nilJSON) != "null" {
+		t.Errorf("Expected nil NullableFloat64 to marshal to %q, got %q", "null", nilJSON)
+	}
+
+	val := 150.5
+	valJSON, err := json.Marshal(NullableFloat64{&val})
 	if err != nil {
-		t.Fatalf("Error opening test database: %v", err)
-	}
-
-	query := `
-	CREATE TABLE IF NOT EXISTS securities (
-		ticker TEXT PRIMARY KEY,
-		sma_strategy INTEGER DEFAULT 0,
-		occ INTEGER DEFAULT 0,
-		adaptive_supertrend INTEGER DEFAULT 0,
-		range_filter INTEGER DEFAULT 0,
-		pmax INTEGER DEFAULT 0,
-		shinohara_intensity_ratio INTEGER DEFAULT 0,
-		oscillators INTEGER DEFAULT 0,
-		momentum INTEGER DEFAULT 0
-	);`
-	if _, err := db.Exec(query); err != nil {
-		t.Fatalf("Error creating table in test database: %v", err)
-	}
-
-	t.Cleanup(func() {
-		db.Close()
-		os.Remove(tmpDB)
+		t.Fatalf("Marshal(150.5) failed: %v", err)
+	}
+	if string(valJSON) != "150.5" {
+		t.Errorf("Expected populated NullableFloat64 to marshal to %q, got %q", "150.5", valJSON)
+	}
+}
+
+// TestWebhookHandlerAuth asserts that handleWebhook rejects requests with a
+// missing or invalid HMAC signature and accepts correctly signed ones.
+func TestWebhookHandlerAuth(t *testing.T) {
+	os.Setenv("WEBHOOK_SECRET", "test-secret")
+	t.Cleanup(func() { os.Unsetenv("WEBHOOK_SECRET") })
+
+	s := securitiesTestStore(t)
+	handler := handleWebhook(s, newBroker(), signals.NewEngine(signals.DefaultRuleSet()), newKeyedLimiter(1e6))
+
+	alert := TradingViewAlert{Ticker: "AAPL", Signal: "buy", SignalStrength: 3, VWMAPosition: "above"}
+	jsonBytes, err := json.Marshal(alert)
+	if err != nil {
+		t.Fatalf("Failed to marshal alert: %v", err)
+	}
+
+	t.Run("missing signature", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(jsonBytes))
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status 401 Unauthorized, got %d", rr.Code)
+		}
+	})
+
+	t.Run("invalid signature", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(jsonBytes))
+		req.Header.Set("X-Signature", "deadbeef")
+		req.Header.Set("X-Timestamp", fmt.Sprintf("%d", time.Now().Unix()))
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status 401 Unauthorized, got %d", rr.Code)
+		}
 	})
 
-	return db
+	t.Run("expired timestamp", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(jsonBytes))
+		timestamp := fmt.Sprintf("%d", time.Now().Add(-5*time.Minute).Unix())
+		signWebhookRequest(req, "test-secret", timestamp, jsonBytes)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status 401 Unauthorized, got %d", rr.Code)
+		}
+	})
+
+	t.Run("valid signature", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(jsonBytes))
+		timestamp := fmt.Sprintf("%d", time.Now().Unix())
+		signWebhookRequest(req, "test-secret", timestamp, jsonBytes)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status 200 OK, got %d: %s", rr.Code, rr.Body.String())
+		}
+	})
 }
 
-// TestWebhookHandler sends several simulated webhook calls and checks the response.
-func TestWebhookHandler(t *testing.T) {
-	// Override the Sheets update function to avoid live calls.
-	updateGoogleSheetFn = dummyUpdateGoogleSheet
+// TestStreamEndpoint asserts that a /stream subscriber receives a snapshot
+// on subscribe and a live update once a matching webhook alert is processed.
+func TestStreamEndpoint(t *testing.T) {
+	os.Setenv("WEBHOOK_SECRET", "test-secret")
+	t.Cleanup(func() { os.Unsetenv("WEBHOOK_SECRET") })
+
+	s := securitiesTestStore(t)
+	seed := store.Signal{Ticker: "AAPL", Signal: "sell", SignalStrength: 2, VWMAPosition: "below"}
+	if err := s.UpsertSignal(context.Background(), seed); err != nil {
+		t.Fatalf("Failed to seed securities row: %v", err)
+	}
+
+	b := newBroker()
 
-	db := testDB(t)
-	handler := handleWebhook(db)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webhook", handleWebhook(s, b, signals.NewEngine(signals.DefaultRuleSet()), newKeyedLimiter(1e6)))
+	mux.HandleFunc("/stream", handleStream(s, b))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
 
-	// Define several test alerts for different tickers/indicators.
-	testAlerts := []TradingViewAlert{
-		{Ticker: "AAPL", Indicator: "sma_strategy", Signal: 2, Comment: "Buy signal"},
-		{Ticker: "GOOG", Indicator: "occ", Signal: 1, Comment: "Neutral signal"},
-		{Ticker: "MSFT", Indicator: "pmax", Signal: 0, Comment: "Sell signal"},
+	wsURL := "ws" + server.URL[len("http"):] + "/stream"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial stream websocket: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	sub := subscribeRequest{Action: "subscribe", Channel: "signals", Tickers: []string{"AAPL"}}
+	if err := conn.WriteJSON(sub); err != nil {
+		t.Fatalf("Failed to send subscribe message: %v", err)
+	}
+
+	var snapshot streamEvent
+	if err := conn.ReadJSON(&snapshot); err != nil {
+		t.Fatalf("Failed to read snapshot event: %v", err)
+	}
+	if snapshot.Type != "snapshot" || snapshot.Channel != channelSignals {
+		t.Errorf("Expected initial signals snapshot, got %+v", snapshot)
 	}
 
-	for _, alert := range testAlerts {
-		t.Run(alert.Ticker+"_"+alert.Indicator, func(t *testing.T) {
+	alert := TradingViewAlert{Ticker: "AAPL", Signal: "buy", SignalStrength: 4, VWMAPosition: "above"}
+	jsonBytes, err := json.Marshal(alert)
+	if err != nil {
+		t.Fatalf("Failed to marshal alert: %v", err)
+	}
+	req, err := http.NewRequest("POST", server.URL+"/webhook", bytes.NewReader(jsonBytes))
+	if err != nil {
+		t.Fatalf("Failed to build webhook request: %v", err)
+	}
+	timestamp := fmt.Sprintf("%d", time.Now().Unix())
+	signWebhookRequest(req, "test-secret", timestamp, jsonBytes)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to POST webhook: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected webhook status 200 OK, got %d", resp.StatusCode)
+	}
+
+	var update streamEvent
+	if err := conn.ReadJSON(&update); err != nil {
+		t.Fatalf("Failed to read update event: %v", err)
+	}
+	if update.Type != "update" || update.Channel != channelSignals || update.Ticker != "AAPL" {
+		t.Errorf("Expected signals update for AAPL, got %+v", update)
+	}
+}
+
+// TestWebhookHandlerIndicatorAlerts replays a 10-call indicator-alert
+// sequence for one ticker through handleWebhook and asserts the composite
+// signals engine lands on the expected decision and persists it to the
+// store.
+func TestWebhookHandlerIndicatorAlerts(t *testing.T) {
+	os.Setenv("WEBHOOK_SECRET", "test-secret")
+	t.Cleanup(func() { os.Unsetenv("WEBHOOK_SECRET") })
+
+	s := securitiesTestStore(t)
+	engine := signals.NewEngine(signals.DefaultRuleSet())
+	handler := handleWebhook(s, newBroker(), engine, newKeyedLimiter(1e6))
+
+	ticker := "ASX: Meeka Metals Limited"
+	alerts := []TradingViewAlert{
+		{Ticker: ticker, Indicator: "sma_strategy", IndicatorValue: 2},
+		{Ticker: ticker, Indicator: "occ", IndicatorValue: 2},
+		{Ticker: ticker, Indicator: "adaptive_supertrend", IndicatorValue: 2},
+		{Ticker: ticker, Indicator: "range_filter", IndicatorValue: 2},
+		{Ticker: ticker, Indicator: "pmax", IndicatorValue: 2},
+		{Ticker: ticker, Indicator: "shinohara_intensity_ratio", IndicatorValue: 2},
+		{Ticker: ticker, Indicator: "oscillators", IndicatorValue: 1},
+		{Ticker: ticker, Indicator: "sma_strategy", IndicatorValue: 2},
+		{Ticker: ticker, Indicator: "occ", IndicatorValue: 2},
+		{Ticker: ticker, Indicator: "pmax", IndicatorValue: 2},
+	}
+
+	for i, alert := range alerts {
+		t.Run(fmt.Sprintf("Call_%d", i+1), func(t *testing.T) {
 			jsonBytes, err := json.Marshal(alert)
 			if err != nil {
 				t.Fatalf("Failed to marshal alert: %v", err)
 			}
 			req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(jsonBytes))
-			req.Header.Set("Content-Type", "application/json")
+			timestamp := fmt.Sprintf("%d", time.Now().Unix())
+			signWebhookRequest(req, "test-secret", timestamp, jsonBytes)
 			rr := httptest.NewRecorder()
-
 			handler(rr, req)
-
 			if rr.Code != http.StatusOK {
-				t.Errorf("Expected status 200 OK, got %d", rr.Code)
-			}
-			expected := "Webhook processed successfully"
-			if rr.Body.String() != expected {
-				t.Errorf("Unexpected response body: got %q, want %q", rr.Body.String(), expected)
+				t.Errorf("Expected status 200 OK, got %d: %s", rr.Code, rr.Body.String())
 			}
 		})
 	}
+
+	securities, err := s.ListSecurities(context.Background())
+	if err != nil {
+		t.Fatalf("ListSecurities failed: %v", err)
+	}
+	var found bool
+	for _, sec := range securities {
+		if sec.Ticker == ticker {
+			found = true
+			if sec.CompositeSignal != "buy" {
+				t.Errorf("Expected composite signal %q for %s, got %q", "buy", ticker, sec.CompositeSignal)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Expected %s to appear in ListSecurities, got %+v", ticker, securities)
+	}
 }
 
-// TestMultipleWebhookCalls simulates multiple webhook calls for one ticker.
-func TestMultipleWebhookCalls(t *testing.T) {
-	updateGoogleSheetFn = dummyUpdateGoogleSheet
-	db := testDB(t)
-	handler := handleWebhook(db)
+// TestHistoryEndpoints replays a sequence of indicator alerts that flip
+// between buy and sell, with an analystPriceTarget attached to each so
+// holds can be graded, then asserts /history pagination and /history/stats
+// aggregation.
+func TestHistoryEndpoints(t *testing.T) {
+	os.Setenv("WEBHOOK_SECRET", "test-secret")
+	t.Cleanup(func() { os.Unsetenv("WEBHOOK_SECRET") })
 
-	// Simulate 10 calls for the ticker "ASX: Meeka Metals Limited" with various indicators.
-	alerts := []TradingViewAlert{
-		{Ticker: "ASX: Meeka Metals Limited", Indicator: "sma_strategy", Signal: 2, Comment: "Call 1"},
-		{Ticker: "ASX: Meeka Metals Limited", Indicator: "occ", Signal: 2, Comment: "Call 2"},
-		{Ticker: "ASX: Meeka Metals Limited", Indicator: "adaptive_supertrend", Signal: 2, Comment: "Call 3"},
-		{Ticker: "ASX: Meeka Metals Limited", Indicator: "range_filter", Signal: 2, Comment: "Call 4"},
-		{Ticker: "ASX: Meeka Metals Limited", Indicator: "pmax", Signal: 2, Comment: "Call 5"},
-		{Ticker: "ASX: Meeka Metals Limited", Indicator: "shinohara_intensity_ratio", Signal: 2, Comment: "Call 6"},
-		{Ticker: "ASX: Meeka Metals Limited", Indicator: "oscillators", Signal: 1, Comment: "Call 7"},
-		{Ticker: "ASX: Meeka Metals Limited", Indicator: "sma_strategy", Signal: 2, Comment: "Call 8"},
-		{Ticker: "ASX: Meeka Metals Limited", Indicator: "occ", Signal: 2, Comment: "Call 9"},
-		{Ticker: "ASX: Meeka Metals Limited", Indicator: "pmax", Signal: 2, Comment: "Call 10"},
-	}
-
-	// Send each simulated webhook call.
-	for i, alert := range alerts {
+	s := securitiesTestStore(t)
+	engine := signals.NewEngine(signals.DefaultRuleSet())
+	b := newBroker()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webhook", handleWebhook(s, b, engine, newKeyedLimiter(1e6)))
+	mux.HandleFunc("/history", handleHistory(s))
+	mux.HandleFunc("/history/stats", handleHistoryStats(s))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	ticker := "HIST_CO"
+	type call struct {
+		value       int
+		priceTarget float64
+	}
+	calls := []call{
+		{value: 2, priceTarget: 100}, // buy opens a hold at 100
+		{value: 0, priceTarget: 90},  // sell closes the buy hold: price fell -> loss
+		{value: 2, priceTarget: 80},  // buy closes the sell hold: price kept falling -> win
+	}
+	for i, c := range calls {
 		t.Run(fmt.Sprintf("Call_%d", i+1), func(t *testing.T) {
+			alert := TradingViewAlert{
+				Ticker:             ticker,
+				Indicator:          "occ",
+				IndicatorValue:     c.value,
+				AnalystPriceTarget: NullableFloat64{&c.priceTarget},
+			}
 			jsonBytes, err := json.Marshal(alert)
 			if err != nil {
 				t.Fatalf("Failed to marshal alert: %v", err)
 			}
-			req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(jsonBytes))
-			req.Header.Set("Content-Type", "application/json")
-			rr := httptest.NewRecorder()
-			handler(rr, req)
-			if rr.Code != http.StatusOK {
-				t.Errorf("Expected status 200 OK, got %d", rr.Code)
+			req, err := http.NewRequest("POST", server.URL+"/webhook", bytes.NewReader(jsonBytes))
+			if err != nil {
+				t.Fatalf("Failed to build webhook request: %v", err)
+			}
+			timestamp := fmt.Sprintf("%d", time.Now().Unix())
+			signWebhookRequest(req, "test-secret", timestamp, jsonBytes)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Failed to POST webhook: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("Expected webhook status 200 OK, got %d", resp.StatusCode)
 			}
 		})
 	}
 
-	// After all calls, query the database for "ASX: Meeka Metals Limited".
-	row := db.QueryRow(`SELECT sma_strategy, occ, adaptive_supertrend, range_filter, pmax, shinohara_intensity_ratio, oscillators, momentum 
-	                     FROM securities WHERE ticker = ?`, "ASX: Meeka Metals Limited")
-	var sma, occ, adaptive, rangeFilter, pmax, shinohara, oscillators, momentum int
-	if err := row.Scan(&sma, &occ, &adaptive, &rangeFilter, &pmax, &shinohara, &oscillators, &momentum); err != nil {
-		t.Fatalf("Failed to scan row: %v", err)
+	t.Run("history pagination", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/history?ticker=" + ticker + "&limit=2")
+		if err != nil {
+			t.Fatalf("Failed to GET /history: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200 OK, got %d", resp.StatusCode)
+		}
+
+		var page1 historyResponse
+		if err := json.NewDecoder(resp.Body).Decode(&page1); err != nil {
+			t.Fatalf("Failed to decode /history response: %v", err)
+		}
+		if len(page1.Entries) != 2 {
+			t.Fatalf("Expected 2 entries on first page, got %d", len(page1.Entries))
+		}
+		if page1.NextCursor == 0 {
+			t.Fatalf("Expected a non-zero cursor for a full page")
+		}
+
+		resp2, err := http.Get(fmt.Sprintf("%s/history?ticker=%s&limit=2&cursor=%d", server.URL, ticker, page1.NextCursor))
+		if err != nil {
+			t.Fatalf("Failed to GET /history (page 2): %v", err)
+		}
+		defer resp2.Body.Close()
+		var page2 historyResponse
+		if err := json.NewDecoder(resp2.Body).Decode(&page2); err != nil {
+			t.Fatalf("Failed to decode /history page 2 response: %v", err)
+		}
+		if len(page2.Entries) != 1 {
+			t.Fatalf("Expected 1 entry on second page, got %d", len(page2.Entries))
+		}
+		if page2.NextCursor != 0 {
+			t.Errorf("Expected cursor 0 once exhausted, got %d", page2.NextCursor)
+		}
+	})
+
+	t.Run("history csv", func(t *testing.T) {
+		req, err := http.NewRequest("GET", server.URL+"/history?ticker="+ticker, nil)
+		if err != nil {
+			t.Fatalf("Failed to build /history CSV request: %v", err)
+		}
+		req.Header.Set("Accept", "text/csv")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to GET /history as CSV: %v", err)
+		}
+		defer resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); ct != "text/csv" {
+			t.Errorf("Expected Content-Type text/csv, got %q", ct)
+		}
+	})
+
+	t.Run("history stats", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/history/stats?ticker=" + ticker)
+		if err != nil {
+			t.Fatalf("Failed to GET /history/stats: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200 OK, got %d", resp.StatusCode)
+		}
+
+		var stats []map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+			t.Fatalf("Failed to decode /history/stats response: %v", err)
+		}
+		if len(stats) != 1 {
+			t.Fatalf("Expected stats for 1 indicator, got %+v", stats)
+		}
+		if stats[0]["indicator"] != "occ" || stats[0]["wins"] != float64(1) || stats[0]["losses"] != float64(1) {
+			t.Errorf("Expected occ wins=1 losses=1, got %+v", stats[0])
+		}
+	})
+}
+
+// scrapeMetric fetches /metrics from serverURL and returns the value of the
+// sample line whose name+labels exactly match metric, or 0 if absent.
+func scrapeMetric(t *testing.T, serverURL, metric string) float64 {
+	t.Helper()
+	resp, err := http.Get(serverURL + "/metrics")
+	if err != nil {
+		t.Fatalf("Failed to GET /metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read /metrics body: %v", err)
 	}
-	t.Logf("Final values for ASX: Meeka Metals Limited: sma_strategy=%d, occ=%d, adaptive_supertrend=%d, range_filter=%d, pmax=%d, shinohara_intensity_ratio=%d, oscillators=%d, momentum=%d",
-		sma, occ, adaptive, rangeFilter, pmax, shinohara, oscillators, momentum)
+
+	for _, line := range strings.Split(string(body), "\n") {
+		if !strings.HasPrefix(line, metric+" ") {
+			continue
+		}
+		var value float64
+		if _, err := fmt.Sscanf(strings.TrimPrefix(line, metric+" "), "%f", &value); err != nil {
+			t.Fatalf("Failed to parse metric line %q: %v", line, err)
+		}
+		return value
+	}
+	return 0
+}
+
+// TestMetricsEndpoint posts a batch of webhook alerts through the same
+// middleware chain main() wires up, then asserts /metrics reflects the
+// expected counter increments for their outcomes.
+func TestMetricsEndpoint(t *testing.T) {
+	os.Setenv("WEBHOOK_SECRET", "test-secret")
+	t.Cleanup(func() { os.Unsetenv("WEBHOOK_SECRET") })
+
+	s := securitiesTestStore(t)
+	b := newBroker()
+	engine := signals.NewEngine(signals.DefaultRuleSet())
+	registerTrackedTickersGauge(s)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webhook", withRequestLogging(handleWebhook(s, b, engine, newKeyedLimiter(1e6))))
+	mux.Handle("/metrics", promhttp.Handler())
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	okBefore := scrapeMetric(t, server.URL, `webhook_requests_total{result="ok"}`)
+	badBefore := scrapeMetric(t, server.URL, `webhook_requests_total{result="bad_payload"}`)
+
+	alerts := []TradingViewAlert{
+		{Ticker: "METRICS_CO", Signal: "buy", SignalStrength: 3, VWMAPosition: "above"},
+		{Ticker: "METRICS_CO", Signal: "sell", SignalStrength: 2, VWMAPosition: "below"},
+	}
+	for _, alert := range alerts {
+		jsonBytes, err := json.Marshal(alert)
+		if err != nil {
+			t.Fatalf("Failed to marshal alert: %v", err)
+		}
+		req, err := http.NewRequest("POST", server.URL+"/webhook", bytes.NewReader(jsonBytes))
+		if err != nil {
+			t.Fatalf("Failed to build webhook request: %v", err)
+		}
+		timestamp := fmt.Sprintf("%d", time.Now().Unix())
+		signWebhookRequest(req, "test-secret", timestamp, jsonBytes)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to POST webhook: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected webhook status 200 OK, got %d", resp.StatusCode)
+		}
+	}
+
+	// An unsigned request should be rejected and counted as bad_payload.
+	unsigned := httptest.NewRequest("POST", "/webhook", bytes.NewReader([]byte(`{}`)))
+	rr := httptest.NewRecorder()
+	withRequestLogging(handleWebhook(s, b, engine, newKeyedLimiter(1e6)))(rr, unsigned)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 Unauthorized, got %d", rr.Code)
+	}
+
+	okAfter := scrapeMetric(t, server.URL, `webhook_requests_total{result="ok"}`)
+	if okAfter-okBefore != float64(len(alerts)) {
+		t.Errorf("Expected webhook_requests_total{result=\"ok\"} to increase by %d, got delta %v", len(alerts), okAfter-okBefore)
+	}
+
+	badAfter := scrapeMetric(t, server.URL, `webhook_requests_total{result="bad_payload"}`)
+	if badAfter-badBefore != 1 {
+		t.Errorf("Expected webhook_requests_total{result=\"bad_payload\"} to increase by 1, got delta %v", badAfter-badBefore)
+	}
+
+	buyCount := scrapeMetric(t, server.URL, `signal_alerts_total{signal="buy"}`)
+	if buyCount < 1 {
+		t.Errorf("Expected signal_alerts_total{signal=\"buy\"} to be at least 1, got %v", buyCount)
+	}
+
+	trackedTickers := scrapeMetric(t, server.URL, "tracked_tickers")
+	if trackedTickers < 1 {
+		t.Errorf("Expected tracked_tickers to be at least 1, got %v", trackedTickers)
+	}
+}
+
+// TestStructuredLoggingEmitsJSON asserts that a request logged through
+// withRequestLogging under the JSON handler main() installs produces a log
+// line that parses as JSON and carries the expected fields, rather than the
+// slog default handler's plain-text format.
+func TestStructuredLoggingEmitsJSON(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	os.Setenv("WEBHOOK_SECRET", "test-secret")
+	t.Cleanup(func() { os.Unsetenv("WEBHOOK_SECRET") })
+
+	s := securitiesTestStore(t)
+	handler := withRequestLogging(handleWebhook(s, newBroker(), signals.NewEngine(signals.DefaultRuleSet()), newKeyedLimiter(1e6)))
+
+	alert := TradingViewAlert{Ticker: "LOG_CO", Signal: "buy", SignalStrength: 1, VWMAPosition: "above"}
+	jsonBytes, err := json.Marshal(alert)
+	if err != nil {
+		t.Fatalf("Failed to marshal alert: %v", err)
+	}
+	req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(jsonBytes))
+	timestamp := fmt.Sprintf("%d", time.Now().Unix())
+	signWebhookRequest(req, "test-secret", timestamp, jsonBytes)
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var found bool
+	for _, line := range lines {
+		var parsed map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &parsed); err != nil {
+			t.Fatalf("Expected every log line to parse as JSON, got %q: %v", line, err)
+		}
+		if parsed["msg"] == "request" && parsed["path"] == "/webhook" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected a JSON request log line for /webhook, got %q", buf.String())
+	}
+}
+
+// TestWebhookRateLimit asserts that withWebhookRateLimit lets a burst up to
+// the configured per-IP QPS through, then returns 429 with a Retry-After
+// header for the next request from the same IP, and that a request for the
+// same ticker from a different IP is unaffected.
+func TestWebhookRateLimit(t *testing.T) {
+	os.Setenv("WEBHOOK_SECRET", "test-secret")
+	t.Cleanup(func() { os.Unsetenv("WEBHOOK_SECRET") })
+
+	s := securitiesTestStore(t)
+	handler := withWebhookRateLimit(2, false)(handleWebhook(s, newBroker(), signals.NewEngine(signals.DefaultRuleSet()), newKeyedLimiter(100)))
+
+	postAlert := func(ip, ticker string) *httptest.ResponseRecorder {
+		alert := TradingViewAlert{Ticker: ticker, Signal: "buy", SignalStrength: 1, VWMAPosition: "above"}
+		jsonBytes, err := json.Marshal(alert)
+		if err != nil {
+			t.Fatalf("Failed to marshal alert: %v", err)
+		}
+		req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(jsonBytes))
+		req.RemoteAddr = ip + ":12345"
+		timestamp := fmt.Sprintf("%d", time.Now().Unix())
+		signWebhookRequest(req, "test-secret", timestamp, jsonBytes)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	for i := 0; i < 2; i++ {
+		if rr := postAlert("203.0.113.1", "RL_CO"); rr.Code != http.StatusOK {
+			t.Fatalf("Expected request %d within the burst to succeed, got %d: %s", i, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := postAlert("203.0.113.1", "RL_CO")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429 once the per-IP burst is exhausted, got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected a Retry-After header on the 429 response")
+	}
+
+	if rr := postAlert("198.51.100.2", "RL_CO"); rr.Code != http.StatusOK {
+		t.Errorf("Expected a request from a different IP to be unaffected, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+// TestWebhookTickerRateLimitRequiresAuth asserts that the per-ticker rate
+// limit is only consumed by requests that pass signature verification, so an
+// unauthenticated caller can't drain a ticker's bucket and get subsequent
+// legitimately signed alerts for it rejected with 429.
+func TestWebhookTickerRateLimitRequiresAuth(t *testing.T) {
+	os.Setenv("WEBHOOK_SECRET", "test-secret")
+	t.Cleanup(func() { os.Unsetenv("WEBHOOK_SECRET") })
+
+	s := securitiesTestStore(t)
+	handler := handleWebhook(s, newBroker(), signals.NewEngine(signals.DefaultRuleSet()), newKeyedLimiter(1))
+
+	postAlert := func(ticker, secret string) *httptest.ResponseRecorder {
+		alert := TradingViewAlert{Ticker: ticker, Signal: "buy", SignalStrength: 1, VWMAPosition: "above"}
+		jsonBytes, err := json.Marshal(alert)
+		if err != nil {
+			t.Fatalf("Failed to marshal alert: %v", err)
+		}
+		req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(jsonBytes))
+		timestamp := fmt.Sprintf("%d", time.Now().Unix())
+		signWebhookRequest(req, secret, timestamp, jsonBytes)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	for i := 0; i < 5; i++ {
+		if rr := postAlert("DOS_CO", "wrong-secret"); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected wrongly signed request %d to be rejected with 401, got %d", i, rr.Code)
+		}
+	}
+
+	if rr := postAlert("DOS_CO", "test-secret"); rr.Code != http.StatusOK {
+		t.Fatalf("Expected a legitimately signed request to still succeed after unauthenticated attempts, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+// TestWebhookRateLimitTrustProxyHeaders asserts that a spoofed
+// X-Forwarded-For header can't be used to bypass the per-IP limiter unless
+// trustProxyHeaders is explicitly enabled, since every request in the test
+// shares the same RemoteAddr.
+func TestWebhookRateLimitTrustProxyHeaders(t *testing.T) {
+	os.Setenv("WEBHOOK_SECRET", "test-secret")
+	t.Cleanup(func() { os.Unsetenv("WEBHOOK_SECRET") })
+
+	postAlert := func(handler http.HandlerFunc, forwardedFor, ticker string) *httptest.ResponseRecorder {
+		alert := TradingViewAlert{Ticker: ticker, Signal: "buy", SignalStrength: 1, VWMAPosition: "above"}
+		jsonBytes, err := json.Marshal(alert)
+		if err != nil {
+			t.Fatalf("Failed to marshal alert: %v", err)
+		}
+		req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(jsonBytes))
+		req.RemoteAddr = "203.0.113.1:12345"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		timestamp := fmt.Sprintf("%d", time.Now().Unix())
+		signWebhookRequest(req, "test-secret", timestamp, jsonBytes)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	t.Run("untrusted headers still rate limit by RemoteAddr", func(t *testing.T) {
+		s := securitiesTestStore(t)
+		handler := withWebhookRateLimit(1, false)(handleWebhook(s, newBroker(), signals.NewEngine(signals.DefaultRuleSet()), newKeyedLimiter(100)))
+
+		if rr := postAlert(handler, "198.51.100.1", "RL_SPOOF"); rr.Code != http.StatusOK {
+			t.Fatalf("Expected first request to succeed, got %d: %s", rr.Code, rr.Body.String())
+		}
+		if rr := postAlert(handler, "198.51.100.2", "RL_SPOOF"); rr.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected a different spoofed X-Forwarded-For to still be rate limited by RemoteAddr, got %d", rr.Code)
+		}
+	})
+
+	t.Run("trusted headers rate limit by X-Forwarded-For", func(t *testing.T) {
+		s := securitiesTestStore(t)
+		handler := withWebhookRateLimit(1, true)(handleWebhook(s, newBroker(), signals.NewEngine(signals.DefaultRuleSet()), newKeyedLimiter(100)))
+
+		if rr := postAlert(handler, "198.51.100.1", "RL_SPOOF"); rr.Code != http.StatusOK {
+			t.Fatalf("Expected first request to succeed, got %d: %s", rr.Code, rr.Body.String())
+		}
+		if rr := postAlert(handler, "198.51.100.2", "RL_SPOOF"); rr.Code != http.StatusOK {
+			t.Errorf("Expected a different X-Forwarded-For to bypass the RemoteAddr-shared limiter when trusted, got %d", rr.Code)
+		}
+	})
+}
+
+// BenchmarkBatchedWebhookWrites fires 10k alerts spread across 100 tickers
+// through a batchingStore-wrapped handleWebhook, reports the resulting
+// throughput, and asserts that every ticker's final signal, indicator
+// reading and composite signal in the underlying store match the last
+// alerts sent for it despite writes being coalesced across many flushes.
+// A third of the alerts are indicator-style (the shape of the
+// TestWebhookHandlerIndicatorAlerts storm), so the benchmark also exercises
+// the UpsertIndicatorReading/SetCompositeSignal batching path, not just
+// UpsertSignal.
+func BenchmarkBatchedWebhookWrites(b *testing.B) {
+	os.Setenv("WEBHOOK_SECRET", "test-secret")
+	b.Cleanup(func() { os.Unsetenv("WEBHOOK_SECRET") })
+
+	const (
+		numTickers         = 100
+		numAlerts          = 10000
+		benchIndicatorName = "occ"
+	)
+
+	dbPath := filepath.Join(b.TempDir(), "securities.db")
+	base, err := store.New(dbPath)
+	if err != nil {
+		b.Fatalf("Error opening bench store: %v", err)
+	}
+	s := newBatchingStore(base, 10*time.Millisecond, 500)
+	b.Cleanup(func() { s.Close() })
+
+	handler := handleWebhook(s, newBroker(), signals.NewEngine(signals.DefaultRuleSet()), newKeyedLimiter(1e6))
+
+	// wantFinal[i] records the signal the last buy/sell alert sent for
+	// ticker i actually carried, and wantFinalIndicator[i] the value the
+	// last indicator alert carried, so the final DB state can be checked
+	// against both.
+	wantFinal := make([]string, numTickers)
+	wantFinalIndicator := make([]int, numTickers)
+
+	b.ResetTimer()
+	for i := 0; i < numAlerts; i++ {
+		idx := i % numTickers
+		ticker := fmt.Sprintf("BATCH_BENCH_%d", idx)
+
+		var alert TradingViewAlert
+		if i%3 == 2 {
+			value := i % 3
+			wantFinalIndicator[idx] = value
+			alert = TradingViewAlert{Ticker: ticker, Indicator: benchIndicatorName, IndicatorValue: value}
+		} else {
+			signal := "buy"
+			if i%3 == 0 {
+				signal = "sell"
+			}
+			wantFinal[idx] = signal
+			alert = TradingViewAlert{Ticker: ticker, Signal: signal, SignalStrength: 1, VWMAPosition: "above"}
+		}
+
+		jsonBytes, err := json.Marshal(alert)
+		if err != nil {
+			b.Fatalf("Failed to marshal alert: %v", err)
+		}
+		req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(jsonBytes))
+		timestamp := fmt.Sprintf("%d", time.Now().Unix())
+		signWebhookRequest(req, "test-secret", timestamp, jsonBytes)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if rr.Code != http.StatusOK {
+			b.Fatalf("Alert %d: expected status 200 OK, got %d: %s", i, rr.Code, rr.Body.String())
+		}
+	}
+	elapsed := b.Elapsed()
+	b.StopTimer()
+
+	// Give the background flush loop a chance to drain the last batch
+	// before reading the underlying store's state directly.
+	time.Sleep(50 * time.Millisecond)
+
+	securities, err := base.ListSecurities(context.Background())
+	if err != nil {
+		b.Fatalf("Failed to list securities: %v", err)
+	}
+	if len(securities) != numTickers {
+		b.Fatalf("Expected %d tickers in the store, got %d", numTickers, len(securities))
+	}
+
+	gotFinal := make(map[string]string, len(securities))
+	gotComposite := make(map[string]string, len(securities))
+	for _, sec := range securities {
+		gotFinal[sec.Ticker] = sec.Signal
+		gotComposite[sec.Ticker] = sec.CompositeSignal
+	}
+
+	// expectedEngine is a throwaway instance (DefaultRuleSet carries no
+	// trailing-activation state) used only to recompute the composite
+	// decision each ticker's final indicator reading should have produced.
+	expectedEngine := signals.NewEngine(signals.DefaultRuleSet())
+	for i, want := range wantFinal {
+		ticker := fmt.Sprintf("BATCH_BENCH_%d", i)
+		if gotFinal[ticker] != want {
+			b.Errorf("Ticker %s: expected final signal %q, got %q", ticker, want, gotFinal[ticker])
+		}
+
+		readings, err := base.IndicatorReadings(context.Background(), ticker)
+		if err != nil {
+			b.Fatalf("IndicatorReadings(%s) failed: %v", ticker, err)
+		}
+		if got := readings[benchIndicatorName]; got != wantFinalIndicator[i] {
+			b.Errorf("Ticker %s: expected final %s reading %d, got %d", ticker, benchIndicatorName, wantFinalIndicator[i], got)
+		}
+
+		wantComposite := expectedEngine.Evaluate(ticker, readings).Signal
+		if gotComposite[ticker] != wantComposite {
+			b.Errorf("Ticker %s: expected composite signal %q, got %q", ticker, wantComposite, gotComposite[ticker])
+		}
+	}
+
+	// Every alert also appends a signal_history row; spot-check that
+	// BatchAppendHistory landed all of them for a couple of tickers instead
+	// of silently dropping any during batching.
+	wantHistoryRows := numAlerts / numTickers
+	for _, idx := range []int{0, numTickers - 1} {
+		ticker := fmt.Sprintf("BATCH_BENCH_%d", idx)
+		entries, _, err := base.ListHistory(context.Background(), store.HistoryFilter{Ticker: ticker, Limit: wantHistoryRows + 1})
+		if err != nil {
+			b.Fatalf("ListHistory(%s) failed: %v", ticker, err)
+		}
+		if len(entries) != wantHistoryRows {
+			b.Errorf("Ticker %s: expected %d history rows, got %d", ticker, wantHistoryRows, len(entries))
+		}
+	}
+
+	b.ReportMetric(float64(numAlerts)/elapsed.Seconds(), "alerts/sec")
 }
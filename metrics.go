@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/tombryson/TradingViewAPI_serivce/pkg/store"
+)
+
+var (
+	// webhookRequestsTotal counts /webhook POST requests by outcome.
+	webhookRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "webhook_requests_total",
+		Help: "Total number of /webhook POST requests, labeled by result (ok, bad_payload, invalid_signal, db_error, rate_limited).",
+	}, []string{"result"})
+
+	// webhookHandlerDuration tracks how long handleWebhook takes to process
+	// a POST request, labeled the same way as webhookRequestsTotal.
+	webhookHandlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "webhook_handler_duration_seconds",
+		Help:    "Latency of the /webhook POST handler in seconds, labeled by result.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"result"})
+
+	// indicatorAlertsTotal counts per-indicator alerts received on /webhook.
+	indicatorAlertsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "indicator_alerts_total",
+		Help: "Total number of indicator alerts received, labeled by indicator.",
+	}, []string{"indicator"})
+
+	// signalAlertsTotal counts buy/sell alerts received on /webhook.
+	signalAlertsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signal_alerts_total",
+		Help: "Total number of buy/sell signal alerts received, labeled by signal.",
+	}, []string{"signal"})
+)
+
+// registerTrackedTickersGauge exposes a gauge of the number of distinct
+// tickers currently tracked in s, sampled fresh on every /metrics scrape.
+func registerTrackedTickersGauge(s store.Store) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "tracked_tickers",
+		Help: "Number of distinct tickers currently tracked.",
+	}, func() float64 {
+		securities, err := s.ListSecurities(context.Background())
+		if err != nil {
+			slog.Error("failed to list securities for tracked_tickers gauge", "error", err)
+			return 0
+		}
+		return float64(len(securities))
+	})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+type contextKey string
+
+const requestIDContextKey contextKey = "requestID"
+
+var requestIDCounter uint64
+
+// nextRequestID returns a process-unique, monotonically increasing id used
+// to correlate a request's log lines.
+func nextRequestID() string {
+	return strconv.FormatUint(atomic.AddUint64(&requestIDCounter, 1), 10)
+}
+
+// requestIDFromContext returns the request id assigned by
+// withRequestLogging, or "" if the request wasn't routed through it.
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+// statusRecorder wraps a ResponseWriter to capture the status code written,
+// since http.ResponseWriter doesn't expose it after the fact.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// withRequestLogging assigns each request a request id (retrievable via
+// requestIDFromContext), then logs one structured line per request with its
+// method, path, status, and elapsed time once the handler returns.
+func withRequestLogging(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := nextRequestID()
+		ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next(rec, r.WithContext(ctx))
+
+		slog.Info("request",
+			"request_id", id,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"elapsed_ms", time.Since(start).Milliseconds(),
+		)
+	}
+}
@@ -0,0 +1,103 @@
+package signals
+
+import "sync"
+
+// Decision is the composite outcome for one ticker: a signal derived from
+// every indicator reading known for it, plus the score that produced it.
+type Decision struct {
+	Ticker string
+	Signal string // "buy", "sell" or "neutral"
+	Score  float64
+}
+
+// tickerState tracks the trailing-activation peak score for one ticker
+// across calls to Engine.Evaluate.
+type tickerState struct {
+	trailingActive bool
+	peakScore      float64
+}
+
+// Engine turns per-indicator readings into a composite Decision according
+// to a RuleSet, re-evaluating on every call and remembering enough
+// per-ticker state to support trailing activation.
+type Engine struct {
+	rules RuleSet
+
+	mu    sync.Mutex
+	state map[string]*tickerState
+}
+
+// NewEngine builds an Engine from rules.
+func NewEngine(rules RuleSet) *Engine {
+	return &Engine{rules: rules, state: make(map[string]*tickerState)}
+}
+
+// Evaluate computes the composite score for ticker from readings (a map of
+// indicator name to its latest reported value) and returns the resulting
+// Decision, applying trailing-activation if the RuleSet configures it.
+func (e *Engine) Evaluate(ticker string, readings map[string]int) Decision {
+	score := e.score(readings)
+
+	signal := "neutral"
+	switch {
+	case score >= e.rules.BuyThreshold:
+		signal = "buy"
+	case score <= e.rules.SellThreshold:
+		signal = "sell"
+	}
+
+	if e.rules.TrailingActivationRatio > 0 && e.rules.BuyThreshold > 0 {
+		signal = e.applyTrailing(ticker, score, signal)
+	}
+
+	return Decision{Ticker: ticker, Signal: signal, Score: score}
+}
+
+func (e *Engine) score(readings map[string]int) float64 {
+	var score float64
+	for indicator, value := range readings {
+		weight, ok := e.rules.Weights[indicator]
+		if !ok {
+			weight = 1
+		}
+		score += weight * float64(value)
+	}
+	return score
+}
+
+// applyTrailing tracks the running peak score for ticker once it crosses
+// the activation threshold, and drops the signal to neutral if the score
+// falls back by TrailingCallbackRate from that peak.
+func (e *Engine) applyTrailing(ticker string, score float64, signal string) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	st, ok := e.state[ticker]
+	if !ok {
+		st = &tickerState{}
+		e.state[ticker] = st
+	}
+
+	activation := e.rules.BuyThreshold * e.rules.TrailingActivationRatio
+	if signal == "buy" && score >= activation {
+		st.trailingActive = true
+		if score > st.peakScore {
+			st.peakScore = score
+		}
+	}
+
+	if st.trailingActive {
+		callback := st.peakScore * (1 - e.rules.TrailingCallbackRate)
+		if score < callback {
+			signal = "neutral"
+			st.trailingActive = false
+			st.peakScore = 0
+		}
+	}
+
+	if signal != "buy" && !st.trailingActive {
+		st.peakScore = 0
+	}
+
+	return signal
+}
@@ -0,0 +1,114 @@
+package signals
+
+import "testing"
+
+// meekaCall is one of the ten simulated webhook calls from
+// TestWebhookHandlerIndicatorAlerts in main_test.go, replayed here against
+// the composite engine instead of the HTTP handler.
+type meekaCall struct {
+	indicator string
+	value     int
+}
+
+var meekaCalls = []meekaCall{
+	{IndicatorSMAStrategy, 2},
+	{IndicatorOCC, 2},
+	{IndicatorAdaptiveSupertrend, 2},
+	{IndicatorRangeFilter, 2},
+	{IndicatorPMax, 2},
+	{IndicatorShinoharaIntensityRatio, 2},
+	{IndicatorOscillators, 1},
+	{IndicatorSMAStrategy, 2},
+	{IndicatorOCC, 2},
+	{IndicatorPMax, 2},
+}
+
+// replayMeekaCalls feeds the ten calls through the engine in order,
+// accumulating the latest reading per indicator the way the webhook
+// handler accumulates rows in the indicator_readings table, and returns the final
+// Decision.
+func replayMeekaCalls(e *Engine) Decision {
+	const ticker = "ASX: Meeka Metals Limited"
+	readings := make(map[string]int)
+
+	var decision Decision
+	for _, call := range meekaCalls {
+		readings[call.indicator] = call.value
+		decision = e.Evaluate(ticker, cloneReadings(readings))
+	}
+	return decision
+}
+
+func cloneReadings(readings map[string]int) map[string]int {
+	clone := make(map[string]int, len(readings))
+	for k, v := range readings {
+		clone[k] = v
+	}
+	return clone
+}
+
+func TestEngineDefaultRuleSet(t *testing.T) {
+	e := NewEngine(DefaultRuleSet())
+	decision := replayMeekaCalls(e)
+
+	// Final readings: six indicators at 2 (buy), oscillators at 1
+	// (neutral), momentum never reported (treated as 0) -> score 13,
+	// which clears the default buy threshold of 12.
+	if decision.Signal != "buy" {
+		t.Errorf("Expected composite signal %q, got %q (score %v)", "buy", decision.Signal, decision.Score)
+	}
+	if decision.Score != 13 {
+		t.Errorf("Expected composite score 13, got %v", decision.Score)
+	}
+}
+
+func TestEngineStrictRuleSet(t *testing.T) {
+	// A stricter rule set that also weighs momentum heavily: since
+	// momentum is never reported in the replayed sequence, its implicit
+	// zero reading should be enough to keep the composite from reaching
+	// a much higher buy threshold.
+	rules := DefaultRuleSet()
+	rules.Weights[IndicatorMomentum] = 4
+	rules.BuyThreshold = 20
+
+	e := NewEngine(rules)
+	decision := replayMeekaCalls(e)
+
+	if decision.Signal != "neutral" {
+		t.Errorf("Expected composite signal %q, got %q (score %v)", "neutral", decision.Signal, decision.Score)
+	}
+}
+
+func TestEngineTrailingActivation(t *testing.T) {
+	rules := RuleSet{
+		Weights:                 map[string]float64{"x": 1},
+		BuyThreshold:            10,
+		SellThreshold:           0,
+		TrailingActivationRatio: 0.8,
+		TrailingCallbackRate:    0.25,
+	}
+	e := NewEngine(rules)
+
+	if d := e.Evaluate("T", map[string]int{"x": 20}); d.Signal != "buy" {
+		t.Fatalf("Expected initial signal %q, got %q", "buy", d.Signal)
+	}
+	// Score pulls back by more than the 25% callback from the peak of 20
+	// (i.e. below 15) while staying above BuyThreshold and never touching
+	// SellThreshold; trailing logic should still flip the signal to neutral.
+	if d := e.Evaluate("T", map[string]int{"x": 12}); d.Signal != "neutral" {
+		t.Errorf("Expected trailing callback to produce %q, got %q (score %v)", "neutral", d.Signal, d.Score)
+	}
+}
+
+func TestLoadRuleSet(t *testing.T) {
+	rules, err := LoadRuleSet("testdata/strict.yaml")
+	if err != nil {
+		t.Fatalf("LoadRuleSet failed: %v", err)
+	}
+	if rules.BuyThreshold != 20 {
+		t.Errorf("Expected buyThreshold 20, got %v", rules.BuyThreshold)
+	}
+	if rules.Weights[IndicatorMomentum] != 4 {
+		t.Errorf("Expected momentum weight 4, got %v", rules.Weights[IndicatorMomentum])
+	}
+}
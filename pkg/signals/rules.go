@@ -0,0 +1,75 @@
+// Package signals aggregates the per-indicator alerts TradingView sends for
+// a ticker into a single composite buy/sell/neutral decision, driven by a
+// user-defined YAML rule file.
+package signals
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Indicator names this engine understands, matching the eight columns
+// TradingView alerts report per ticker.
+const (
+	IndicatorSMAStrategy             = "sma_strategy"
+	IndicatorOCC                     = "occ"
+	IndicatorAdaptiveSupertrend      = "adaptive_supertrend"
+	IndicatorRangeFilter             = "range_filter"
+	IndicatorPMax                    = "pmax"
+	IndicatorShinoharaIntensityRatio = "shinohara_intensity_ratio"
+	IndicatorOscillators             = "oscillators"
+	IndicatorMomentum                = "momentum"
+)
+
+// RuleSet configures how indicator readings are combined into a composite
+// score and, from that score, a buy/sell/neutral decision. TrailingActivationRatio
+// and TrailingCallbackRate mirror the same knobs used by the elliottwave
+// strategy config: once the signal is buy and the score is at or above
+// BuyThreshold * TrailingActivationRatio, the engine tracks the running peak
+// score for that ticker and drops the
+// signal back to neutral if the score falls back by TrailingCallbackRate
+// from that peak, instead of waiting for it to cross SellThreshold outright.
+type RuleSet struct {
+	Weights                 map[string]float64 `yaml:"weights"`
+	BuyThreshold            float64            `yaml:"buyThreshold"`
+	SellThreshold           float64            `yaml:"sellThreshold"`
+	TrailingActivationRatio float64            `yaml:"trailingActivationRatio"`
+	TrailingCallbackRate    float64            `yaml:"trailingCallbackRate"`
+}
+
+// LoadRuleSet reads and parses a RuleSet from a YAML file at path.
+func LoadRuleSet(path string) (RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return RuleSet{}, fmt.Errorf("signals: failed to read rule file %s: %w", path, err)
+	}
+
+	var rules RuleSet
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return RuleSet{}, fmt.Errorf("signals: failed to parse rule file %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// DefaultRuleSet weighs every indicator equally (on the
+// TestWebhookHandlerIndicatorAlerts scale of 0=sell, 1=neutral, 2=buy, so
+// eight indicators score 0..16) and flips the composite signal to buy at a
+// score of 12 or more and to sell at 4 or less, with no trailing logic.
+func DefaultRuleSet() RuleSet {
+	return RuleSet{
+		Weights: map[string]float64{
+			IndicatorSMAStrategy:             1,
+			IndicatorOCC:                     1,
+			IndicatorAdaptiveSupertrend:      1,
+			IndicatorRangeFilter:             1,
+			IndicatorPMax:                    1,
+			IndicatorShinoharaIntensityRatio: 1,
+			IndicatorOscillators:             1,
+			IndicatorMomentum:                1,
+		},
+		BuyThreshold:  12,
+		SellThreshold: 4,
+	}
+}
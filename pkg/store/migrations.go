@@ -0,0 +1,68 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"sort"
+)
+
+// dialect captures the handful of SQL differences between backends needed
+// to track and apply schema_migrations.
+type dialect interface {
+	createMigrationsTableSQL() string
+	placeholder(n int) string
+}
+
+// runMigrations applies every *.sql file under dir in an embedded
+// filesystem, in filename order, that hasn't already been recorded in
+// schema_migrations. Filenames are expected to start with a zero-padded
+// sequence number, e.g. 0001_create_securities.sql, so that new columns
+// can be added as later migrations instead of destroying and recreating
+// the database.
+func runMigrations(db *sql.DB, migrations fs.FS, dir string, d dialect) error {
+	if _, err := db.Exec(d.createMigrationsTableSQL()); err != nil {
+		return fmt.Errorf("store: failed to create schema_migrations table: %w", err)
+	}
+
+	entries, err := fs.ReadDir(migrations, dir)
+	if err != nil {
+		return fmt.Errorf("store: failed to read migrations: %w", err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for i, entry := range entries {
+		version := i + 1
+
+		var applied bool
+		row := db.QueryRow(fmt.Sprintf("SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version = %s)", d.placeholder(1)), version)
+		if err := row.Scan(&applied); err != nil {
+			return fmt.Errorf("store: failed to check migration %s: %w", entry.Name(), err)
+		}
+		if applied {
+			continue
+		}
+
+		contents, err := fs.ReadFile(migrations, dir+"/"+entry.Name())
+		if err != nil {
+			return fmt.Errorf("store: failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("store: failed to begin migration %s: %w", entry.Name(), err)
+		}
+		if _, err := tx.Exec(string(contents)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("store: failed to apply migration %s: %w", entry.Name(), err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("INSERT INTO schema_migrations (version) VALUES (%s)", d.placeholder(1)), version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("store: failed to record migration %s: %w", entry.Name(), err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("store: failed to commit migration %s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,428 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrationsFS embed.FS
+
+const defaultSQLitePath = "/data/stockmomentum.db"
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) createMigrationsTableSQL() string {
+	return `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+}
+
+func (sqliteDialect) placeholder(int) string { return "?" }
+
+type sqliteStore struct {
+	db *sql.DB
+}
+
+func newSQLiteStore(path string) (Store, error) {
+	if path == "" {
+		path = defaultSQLitePath
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("store: failed to open sqlite database: %w", err)
+	}
+
+	if err := runMigrations(db, sqliteMigrationsFS, "migrations/sqlite", sqliteDialect{}); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqliteStore{db: db}, nil
+}
+
+func (s *sqliteStore) UpsertSignal(ctx context.Context, sig Signal) error {
+	var priceTarget interface{}
+	if sig.AnalystPriceTarget != nil {
+		priceTarget = *sig.AnalystPriceTarget
+	}
+	var signalDate interface{}
+	if sig.SignalDate != nil {
+		signalDate = *sig.SignalDate
+	}
+
+	query := `
+	INSERT INTO securities (ticker, signal, signal_strength, vwma_position, analyst_price_target, date_updated, signal_date)
+	VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP, ?)
+	ON CONFLICT(ticker) DO UPDATE SET
+		signal = excluded.signal,
+		signal_strength = excluded.signal_strength,
+		vwma_position = excluded.vwma_position,
+		analyst_price_target = excluded.analyst_price_target,
+		date_updated = CURRENT_TIMESTAMP,
+		signal_date = excluded.signal_date;`
+	_, err := s.db.ExecContext(ctx, query, sig.Ticker, sig.Signal, sig.SignalStrength, sig.VWMAPosition, priceTarget, signalDate)
+	return err
+}
+
+func (s *sqliteStore) BatchUpsertSignals(ctx context.Context, sigs []Signal) error {
+	if len(sigs) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var query strings.Builder
+	query.WriteString("INSERT INTO securities (ticker, signal, signal_strength, vwma_position, analyst_price_target, date_updated, signal_date) VALUES ")
+	args := make([]interface{}, 0, len(sigs)*6)
+	for i, sig := range sigs {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(?, ?, ?, ?, ?, CURRENT_TIMESTAMP, ?)")
+
+		var priceTarget interface{}
+		if sig.AnalystPriceTarget != nil {
+			priceTarget = *sig.AnalystPriceTarget
+		}
+		var signalDate interface{}
+		if sig.SignalDate != nil {
+			signalDate = *sig.SignalDate
+		}
+		args = append(args, sig.Ticker, sig.Signal, sig.SignalStrength, sig.VWMAPosition, priceTarget, signalDate)
+	}
+	query.WriteString(`
+	ON CONFLICT(ticker) DO UPDATE SET
+		signal = excluded.signal,
+		signal_strength = excluded.signal_strength,
+		vwma_position = excluded.vwma_position,
+		analyst_price_target = excluded.analyst_price_target,
+		date_updated = CURRENT_TIMESTAMP,
+		signal_date = excluded.signal_date;`)
+
+	if _, err := tx.ExecContext(ctx, query.String(), args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) UpsertVWMA(ctx context.Context, ticker string, signalStrength int, vwmaPosition string, priceTarget *float64) error {
+	var pt interface{}
+	if priceTarget != nil {
+		pt = *priceTarget
+	}
+
+	query := `
+	INSERT INTO securities (ticker, signal_strength, vwma_position, analyst_price_target, date_updated)
+	VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(ticker) DO UPDATE SET
+		signal_strength = excluded.signal_strength,
+		vwma_position = excluded.vwma_position,
+		analyst_price_target = excluded.analyst_price_target,
+		date_updated = CURRENT_TIMESTAMP;`
+	_, err := s.db.ExecContext(ctx, query, ticker, signalStrength, vwmaPosition, pt)
+	return err
+}
+
+func (s *sqliteStore) GetCurrentSignal(ctx context.Context, ticker string) (Signal, error) {
+	var signal sql.NullString
+	var signalDate sql.NullTime
+
+	row := s.db.QueryRowContext(ctx, "SELECT signal, signal_date FROM securities WHERE ticker = ?", ticker)
+	if err := row.Scan(&signal, &signalDate); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Signal{}, ErrNotFound
+		}
+		return Signal{}, err
+	}
+
+	sig := Signal{Ticker: ticker, Signal: signal.String}
+	if signalDate.Valid {
+		t := signalDate.Time
+		sig.SignalDate = &t
+	}
+	return sig, nil
+}
+
+func (s *sqliteStore) ListSecurities(ctx context.Context) ([]Signal, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT ticker, signal, signal_strength, vwma_position, analyst_price_target, date_updated, signal_date, composite_signal FROM securities")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []Signal
+	for rows.Next() {
+		var sig Signal
+		var signal, compositeSignal sql.NullString
+		var priceTarget sql.NullFloat64
+		var dateUpdated, signalDate sql.NullTime
+		if err := rows.Scan(&sig.Ticker, &signal, &sig.SignalStrength, &sig.VWMAPosition, &priceTarget, &dateUpdated, &signalDate, &compositeSignal); err != nil {
+			return nil, err
+		}
+		sig.Signal = signal.String
+		if priceTarget.Valid {
+			v := priceTarget.Float64
+			sig.AnalystPriceTarget = &v
+		}
+		if dateUpdated.Valid {
+			sig.DateUpdated = dateUpdated.Time
+		}
+		if signalDate.Valid {
+			t := signalDate.Time
+			sig.SignalDate = &t
+		}
+		sig.CompositeSignal = compositeSignal.String
+		result = append(result, sig)
+	}
+	return result, rows.Err()
+}
+
+func (s *sqliteStore) Delete(ctx context.Context, ticker string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM securities WHERE ticker = ?", ticker)
+	return err
+}
+
+func (s *sqliteStore) UpsertIndicatorReading(ctx context.Context, ticker, indicator string, value int) error {
+	query := `
+	INSERT INTO indicator_readings (ticker, indicator, value, updated_at)
+	VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(ticker, indicator) DO UPDATE SET
+		value = excluded.value,
+		updated_at = CURRENT_TIMESTAMP;`
+	_, err := s.db.ExecContext(ctx, query, ticker, indicator, value)
+	return err
+}
+
+func (s *sqliteStore) BatchUpsertIndicatorReadings(ctx context.Context, readings []IndicatorReading) error {
+	if len(readings) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var query strings.Builder
+	query.WriteString("INSERT INTO indicator_readings (ticker, indicator, value, updated_at) VALUES ")
+	args := make([]interface{}, 0, len(readings)*3)
+	for i, r := range readings {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(?, ?, ?, CURRENT_TIMESTAMP)")
+		args = append(args, r.Ticker, r.Indicator, r.Value)
+	}
+	query.WriteString(`
+	ON CONFLICT(ticker, indicator) DO UPDATE SET
+		value = excluded.value,
+		updated_at = CURRENT_TIMESTAMP;`)
+
+	if _, err := tx.ExecContext(ctx, query.String(), args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) IndicatorReadings(ctx context.Context, ticker string) (map[string]int, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT indicator, value FROM indicator_readings WHERE ticker = ?", ticker)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	readings := make(map[string]int)
+	for rows.Next() {
+		var indicator string
+		var value int
+		if err := rows.Scan(&indicator, &value); err != nil {
+			return nil, err
+		}
+		readings[indicator] = value
+	}
+	return readings, rows.Err()
+}
+
+func (s *sqliteStore) SetCompositeSignal(ctx context.Context, ticker, compositeSignal string) error {
+	query := `
+	INSERT INTO securities (ticker, composite_signal) VALUES (?, ?)
+	ON CONFLICT(ticker) DO UPDATE SET composite_signal = excluded.composite_signal;`
+	_, err := s.db.ExecContext(ctx, query, ticker, compositeSignal)
+	return err
+}
+
+func (s *sqliteStore) BatchSetCompositeSignals(ctx context.Context, updates []CompositeSignalUpdate) error {
+	if len(updates) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var query strings.Builder
+	query.WriteString("INSERT INTO securities (ticker, composite_signal) VALUES ")
+	args := make([]interface{}, 0, len(updates)*2)
+	for i, u := range updates {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(?, ?)")
+		args = append(args, u.Ticker, u.CompositeSignal)
+	}
+	query.WriteString(" ON CONFLICT(ticker) DO UPDATE SET composite_signal = excluded.composite_signal;")
+
+	if _, err := tx.ExecContext(ctx, query.String(), args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) AppendHistory(ctx context.Context, entry HistoryEntry) error {
+	var priceTarget interface{}
+	if entry.AnalystPriceTarget != nil {
+		priceTarget = *entry.AnalystPriceTarget
+	}
+
+	query := `
+	INSERT INTO signal_history (ticker, indicator, signal, signal_strength, vwma_position, analyst_price_target, received_at)
+	VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP);`
+	_, err := s.db.ExecContext(ctx, query, entry.Ticker, entry.Indicator, entry.Signal, entry.SignalStrength, entry.VWMAPosition, priceTarget)
+	return err
+}
+
+func (s *sqliteStore) BatchAppendHistory(ctx context.Context, entries []HistoryEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var query strings.Builder
+	query.WriteString("INSERT INTO signal_history (ticker, indicator, signal, signal_strength, vwma_position, analyst_price_target, received_at) VALUES ")
+	args := make([]interface{}, 0, len(entries)*6)
+	for i, entry := range entries {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)")
+
+		var priceTarget interface{}
+		if entry.AnalystPriceTarget != nil {
+			priceTarget = *entry.AnalystPriceTarget
+		}
+		args = append(args, entry.Ticker, entry.Indicator, entry.Signal, entry.SignalStrength, entry.VWMAPosition, priceTarget)
+	}
+	query.WriteString(";")
+
+	if _, err := tx.ExecContext(ctx, query.String(), args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) ListHistory(ctx context.Context, f HistoryFilter) ([]HistoryEntry, int64, error) {
+	query := `SELECT id, ticker, indicator, signal, signal_strength, vwma_position, analyst_price_target, received_at
+	FROM signal_history WHERE ticker = ?`
+	args := []interface{}{f.Ticker}
+
+	if f.Indicator != "" {
+		query += " AND indicator = ?"
+		args = append(args, f.Indicator)
+	}
+	if f.From != nil {
+		query += " AND received_at >= ?"
+		args = append(args, *f.From)
+	}
+	if f.To != nil {
+		query += " AND received_at <= ?"
+		args = append(args, *f.To)
+	}
+	if f.Cursor > 0 {
+		query += " AND id > ?"
+		args = append(args, f.Cursor)
+	}
+	query += " ORDER BY received_at ASC, id ASC LIMIT ?"
+	args = append(args, f.Limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var entries []HistoryEntry
+	for rows.Next() {
+		var e HistoryEntry
+		var priceTarget sql.NullFloat64
+		if err := rows.Scan(&e.ID, &e.Ticker, &e.Indicator, &e.Signal, &e.SignalStrength, &e.VWMAPosition, &priceTarget, &e.ReceivedAt); err != nil {
+			return nil, 0, err
+		}
+		if priceTarget.Valid {
+			v := priceTarget.Float64
+			e.AnalystPriceTarget = &v
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var nextCursor int64
+	if len(entries) == f.Limit {
+		nextCursor = entries[len(entries)-1].ID
+	}
+	return entries, nextCursor, nil
+}
+
+func (s *sqliteStore) HistoryStats(ctx context.Context, ticker string) ([]IndicatorStats, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, ticker, indicator, signal, signal_strength, vwma_position, analyst_price_target, received_at
+	FROM signal_history WHERE ticker = ? AND indicator != '' ORDER BY indicator ASC, received_at ASC, id ASC`, ticker)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []HistoryEntry
+	for rows.Next() {
+		var e HistoryEntry
+		var priceTarget sql.NullFloat64
+		if err := rows.Scan(&e.ID, &e.Ticker, &e.Indicator, &e.Signal, &e.SignalStrength, &e.VWMAPosition, &priceTarget, &e.ReceivedAt); err != nil {
+			return nil, err
+		}
+		if priceTarget.Valid {
+			v := priceTarget.Float64
+			e.AnalystPriceTarget = &v
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return computeHistoryStats(entries), nil
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,226 @@
+// Package store abstracts the securities table behind a backend-agnostic
+// interface so the HTTP layer doesn't need to know whether it's talking to
+// SQLite or PostgreSQL.
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Signal is a row of the securities table: the latest known state for one
+// ticker.
+type Signal struct {
+	Ticker             string
+	Signal             string
+	SignalStrength     int
+	VWMAPosition       string
+	AnalystPriceTarget *float64
+	DateUpdated        time.Time
+	SignalDate         *time.Time
+	CompositeSignal    string
+}
+
+// ErrNotFound is returned by GetCurrentSignal when ticker isn't tracked yet.
+var ErrNotFound = errors.New("store: ticker not found")
+
+// HistoryEntry is one row of the signal_history table: a single alert as it
+// was received, kept forever instead of being overwritten like Signal is.
+type HistoryEntry struct {
+	ID                 int64
+	Ticker             string
+	Indicator          string
+	Signal             string
+	SignalStrength     int
+	VWMAPosition       string
+	AnalystPriceTarget *float64
+	ReceivedAt         time.Time
+}
+
+// HistoryFilter narrows a ListHistory query. Ticker is required; Indicator,
+// From and To are optional. Limit caps the page size (callers should
+// default it) and Cursor, when set, resumes after the entry with that ID.
+type HistoryFilter struct {
+	Ticker    string
+	Indicator string
+	From      *time.Time
+	To        *time.Time
+	Limit     int
+	Cursor    int64
+}
+
+// IndicatorReading is one ticker/indicator pair's latest reported value,
+// for callers that coalesce many UpsertIndicatorReading calls into one
+// write.
+type IndicatorReading struct {
+	Ticker    string
+	Indicator string
+	Value     int
+}
+
+// CompositeSignalUpdate is one ticker's newly computed composite decision,
+// for callers that coalesce many SetCompositeSignal calls into one write.
+type CompositeSignalUpdate struct {
+	Ticker          string
+	CompositeSignal string
+}
+
+// IndicatorStats summarizes one indicator's track record for a ticker:
+// how often a held signal was followed by a favorable move in
+// AnalystPriceTarget before the opposing signal appeared, and how long
+// those holds lasted on average.
+type IndicatorStats struct {
+	Indicator      string
+	Wins           int
+	Losses         int
+	AvgHoldingTime time.Duration
+}
+
+// Store is the set of operations handleWebhook and handleDelete need
+// against the securities table.
+type Store interface {
+	// UpsertSignal records a buy/sell signal for s.Ticker, overwriting the
+	// previous signal, strength, VWMA position and price target.
+	UpsertSignal(ctx context.Context, s Signal) error
+	// UpsertVWMA updates the VWMA position and/or price target for ticker
+	// without touching its current buy/sell signal.
+	UpsertVWMA(ctx context.Context, ticker string, signalStrength int, vwmaPosition string, priceTarget *float64) error
+	// BatchUpsertSignals applies every Signal in sigs within a single
+	// transaction, for callers that coalesce many UpsertSignal calls (e.g.
+	// during an alert storm) into one write to cut down on write
+	// amplification.
+	BatchUpsertSignals(ctx context.Context, sigs []Signal) error
+	// GetCurrentSignal returns the current signal and signal_date for
+	// ticker, or ErrNotFound if it isn't tracked yet.
+	GetCurrentSignal(ctx context.Context, ticker string) (Signal, error)
+	// ListSecurities returns every tracked ticker's latest state.
+	ListSecurities(ctx context.Context) ([]Signal, error)
+	// Delete removes ticker from the securities table.
+	Delete(ctx context.Context, ticker string) error
+	// UpsertIndicatorReading records the latest value reported for one
+	// indicator on ticker, to be fed into the signals aggregation engine.
+	UpsertIndicatorReading(ctx context.Context, ticker, indicator string, value int) error
+	// BatchUpsertIndicatorReadings applies every IndicatorReading in
+	// readings within a single transaction, for callers that coalesce many
+	// UpsertIndicatorReading calls (e.g. during an indicator alert storm)
+	// into one write to cut down on write amplification.
+	BatchUpsertIndicatorReadings(ctx context.Context, readings []IndicatorReading) error
+	// IndicatorReadings returns every indicator value known for ticker,
+	// keyed by indicator name.
+	IndicatorReadings(ctx context.Context, ticker string) (map[string]int, error)
+	// SetCompositeSignal records the aggregation engine's latest decision
+	// for ticker.
+	SetCompositeSignal(ctx context.Context, ticker, compositeSignal string) error
+	// BatchSetCompositeSignals applies every CompositeSignalUpdate in
+	// updates within a single transaction, for callers that coalesce many
+	// SetCompositeSignal calls into one write.
+	BatchSetCompositeSignals(ctx context.Context, updates []CompositeSignalUpdate) error
+	// AppendHistory records entry as a new signal_history row, never
+	// overwriting a previous one.
+	AppendHistory(ctx context.Context, entry HistoryEntry) error
+	// BatchAppendHistory records every HistoryEntry in entries as a new
+	// signal_history row within a single transaction, for callers that
+	// buffer history writes to reduce write amplification.
+	BatchAppendHistory(ctx context.Context, entries []HistoryEntry) error
+	// ListHistory returns entries matching f, oldest first, along with the
+	// cursor to pass back for the next page (empty once exhausted).
+	ListHistory(ctx context.Context, f HistoryFilter) (entries []HistoryEntry, nextCursor int64, err error)
+	// HistoryStats computes per-indicator win/loss counts and average
+	// holding time for ticker from its signal_history.
+	HistoryStats(ctx context.Context, ticker string) ([]IndicatorStats, error)
+	// Close releases the underlying database connection(s).
+	Close() error
+}
+
+// computeHistoryStats derives IndicatorStats from entries, which must
+// already be sorted by indicator then received_at. For each indicator, a
+// buy or sell entry opens a "hold" that closes when the opposite signal
+// next appears; the hold is a win if AnalystPriceTarget moved in the held
+// direction (up for a buy, down for a sell) by the time it closed, a loss
+// otherwise. Neutral entries and holds missing a price target on either
+// end are excluded, since there's nothing to grade them against.
+func computeHistoryStats(entries []HistoryEntry) []IndicatorStats {
+	var stats []IndicatorStats
+	var cur *IndicatorStats
+	var open *HistoryEntry
+
+	flush := func() {
+		if cur != nil {
+			stats = append(stats, *cur)
+		}
+	}
+
+	for i := range entries {
+		e := &entries[i]
+		if cur == nil || e.Indicator != cur.Indicator {
+			flush()
+			cur = &IndicatorStats{Indicator: e.Indicator}
+			open = nil
+		}
+
+		if e.Signal != "buy" && e.Signal != "sell" {
+			continue
+		}
+
+		if open != nil && e.Signal != open.Signal {
+			holding := e.ReceivedAt.Sub(open.ReceivedAt)
+			if open.AnalystPriceTarget != nil && e.AnalystPriceTarget != nil {
+				won := (open.Signal == "buy" && *e.AnalystPriceTarget > *open.AnalystPriceTarget) ||
+					(open.Signal == "sell" && *e.AnalystPriceTarget < *open.AnalystPriceTarget)
+				if won {
+					cur.Wins++
+				} else {
+					cur.Losses++
+				}
+				n := cur.Wins + cur.Losses
+				cur.AvgHoldingTime = (cur.AvgHoldingTime*time.Duration(n-1) + holding) / time.Duration(n)
+			}
+			open = e
+		} else if open == nil {
+			open = e
+		}
+	}
+	flush()
+
+	return stats
+}
+
+// New opens a Store based on databaseURL. An empty string opens the
+// default SQLite database; a sqlite://, file:// or bare path also opens
+// SQLite at that path; postgres:// and postgresql:// open PostgreSQL.
+func New(databaseURL string) (Store, error) {
+	if databaseURL == "" {
+		return newSQLiteStore(defaultSQLitePath)
+	}
+
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("store: invalid DATABASE_URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "postgres", "postgresql":
+		return newPostgresStore(databaseURL)
+	case "", "sqlite", "sqlite3", "file":
+		path := u.Opaque
+		if path == "" {
+			path = u.Path
+		}
+		if path == "" {
+			// A relative path with no leading slash (e.g.
+			// sqlite://securities.db, or sqlite://data/securities.db) parses
+			// with the leading path segment in Host rather than Opaque or
+			// Path.
+			path = u.Host + u.Path
+		}
+		if path == "" {
+			path = databaseURL
+		}
+		return newSQLiteStore(path)
+	default:
+		return nil, fmt.Errorf("store: unsupported DATABASE_URL scheme %q", u.Scheme)
+	}
+}
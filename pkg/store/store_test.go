@@ -0,0 +1,314 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// runStoreSuite exercises the Store contract against whatever backend s is
+// wired to, so SQLite and PostgreSQL are verified with identical assertions.
+func runStoreSuite(t *testing.T, s Store) {
+	t.Helper()
+	ctx := context.Background()
+
+	t.Run("GetCurrentSignal not found", func(t *testing.T) {
+		if _, err := s.GetCurrentSignal(ctx, "NOPE"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("UpsertSignal then GetCurrentSignal", func(t *testing.T) {
+		priceTarget := 150.5
+		if err := s.UpsertSignal(ctx, Signal{
+			Ticker:             "AAPL",
+			Signal:             "buy",
+			SignalStrength:     3,
+			VWMAPosition:       "above",
+			AnalystPriceTarget: &priceTarget,
+		}); err != nil {
+			t.Fatalf("UpsertSignal failed: %v", err)
+		}
+
+		got, err := s.GetCurrentSignal(ctx, "AAPL")
+		if err != nil {
+			t.Fatalf("GetCurrentSignal failed: %v", err)
+		}
+		if got.Signal != "buy" {
+			t.Errorf("Expected signal %q, got %q", "buy", got.Signal)
+		}
+	})
+
+	t.Run("UpsertVWMA does not change the signal", func(t *testing.T) {
+		if err := s.UpsertVWMA(ctx, "AAPL", 4, "below", nil); err != nil {
+			t.Fatalf("UpsertVWMA failed: %v", err)
+		}
+
+		got, err := s.GetCurrentSignal(ctx, "AAPL")
+		if err != nil {
+			t.Fatalf("GetCurrentSignal failed: %v", err)
+		}
+		if got.Signal != "buy" {
+			t.Errorf("Expected signal to remain %q after UpsertVWMA, got %q", "buy", got.Signal)
+		}
+	})
+
+	t.Run("ListSecurities includes upserted tickers", func(t *testing.T) {
+		if err := s.UpsertSignal(ctx, Signal{Ticker: "GOOG", Signal: "sell", SignalStrength: 1, VWMAPosition: "below"}); err != nil {
+			t.Fatalf("UpsertSignal failed: %v", err)
+		}
+
+		securities, err := s.ListSecurities(ctx)
+		if err != nil {
+			t.Fatalf("ListSecurities failed: %v", err)
+		}
+
+		tickers := make(map[string]bool, len(securities))
+		for _, sec := range securities {
+			tickers[sec.Ticker] = true
+		}
+		if !tickers["AAPL"] || !tickers["GOOG"] {
+			t.Errorf("Expected AAPL and GOOG in ListSecurities, got %+v", securities)
+		}
+	})
+
+	t.Run("Delete removes a ticker", func(t *testing.T) {
+		if err := s.Delete(ctx, "GOOG"); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		if _, err := s.GetCurrentSignal(ctx, "GOOG"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound after Delete, got %v", err)
+		}
+	})
+
+	t.Run("indicator readings and composite signal round-trip", func(t *testing.T) {
+		if err := s.UpsertIndicatorReading(ctx, "MSFT", "sma_strategy", 2); err != nil {
+			t.Fatalf("UpsertIndicatorReading failed: %v", err)
+		}
+		if err := s.UpsertIndicatorReading(ctx, "MSFT", "occ", 1); err != nil {
+			t.Fatalf("UpsertIndicatorReading failed: %v", err)
+		}
+
+		readings, err := s.IndicatorReadings(ctx, "MSFT")
+		if err != nil {
+			t.Fatalf("IndicatorReadings failed: %v", err)
+		}
+		if readings["sma_strategy"] != 2 || readings["occ"] != 1 {
+			t.Errorf("Expected sma_strategy=2, occ=1, got %+v", readings)
+		}
+
+		if err := s.SetCompositeSignal(ctx, "MSFT", "buy"); err != nil {
+			t.Fatalf("SetCompositeSignal failed: %v", err)
+		}
+		securities, err := s.ListSecurities(ctx)
+		if err != nil {
+			t.Fatalf("ListSecurities failed: %v", err)
+		}
+		var found bool
+		for _, sec := range securities {
+			if sec.Ticker == "MSFT" {
+				found = true
+				if sec.CompositeSignal != "buy" {
+					t.Errorf("Expected composite signal %q, got %q", "buy", sec.CompositeSignal)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("Expected MSFT to appear in ListSecurities after SetCompositeSignal, got %+v", securities)
+		}
+	})
+
+	t.Run("BatchUpsertSignals applies every ticker in one transaction", func(t *testing.T) {
+		batch := []Signal{
+			{Ticker: "NVDA", Signal: "buy", SignalStrength: 2, VWMAPosition: "above"},
+			{Ticker: "AMD", Signal: "sell", SignalStrength: 1, VWMAPosition: "below"},
+		}
+		if err := s.BatchUpsertSignals(ctx, batch); err != nil {
+			t.Fatalf("BatchUpsertSignals failed: %v", err)
+		}
+
+		for _, want := range batch {
+			got, err := s.GetCurrentSignal(ctx, want.Ticker)
+			if err != nil {
+				t.Fatalf("GetCurrentSignal(%s) failed: %v", want.Ticker, err)
+			}
+			if got.Signal != want.Signal {
+				t.Errorf("Ticker %s: expected signal %q, got %q", want.Ticker, want.Signal, got.Signal)
+			}
+		}
+	})
+
+	t.Run("BatchUpsertIndicatorReadings applies every reading in one transaction", func(t *testing.T) {
+		batch := []IndicatorReading{
+			{Ticker: "BA", Indicator: "sma_strategy", Value: 2},
+			{Ticker: "BA", Indicator: "occ", Value: 0},
+		}
+		if err := s.BatchUpsertIndicatorReadings(ctx, batch); err != nil {
+			t.Fatalf("BatchUpsertIndicatorReadings failed: %v", err)
+		}
+
+		readings, err := s.IndicatorReadings(ctx, "BA")
+		if err != nil {
+			t.Fatalf("IndicatorReadings failed: %v", err)
+		}
+		if readings["sma_strategy"] != 2 || readings["occ"] != 0 {
+			t.Errorf("Expected sma_strategy=2, occ=0, got %+v", readings)
+		}
+	})
+
+	t.Run("BatchSetCompositeSignals applies every ticker in one transaction", func(t *testing.T) {
+		batch := []CompositeSignalUpdate{
+			{Ticker: "BA", CompositeSignal: "sell"},
+			{Ticker: "CRM", CompositeSignal: "buy"},
+		}
+		if err := s.BatchSetCompositeSignals(ctx, batch); err != nil {
+			t.Fatalf("BatchSetCompositeSignals failed: %v", err)
+		}
+
+		securities, err := s.ListSecurities(ctx)
+		if err != nil {
+			t.Fatalf("ListSecurities failed: %v", err)
+		}
+		got := make(map[string]string, len(securities))
+		for _, sec := range securities {
+			got[sec.Ticker] = sec.CompositeSignal
+		}
+		for _, want := range batch {
+			if got[want.Ticker] != want.CompositeSignal {
+				t.Errorf("Ticker %s: expected composite signal %q, got %q", want.Ticker, want.CompositeSignal, got[want.Ticker])
+			}
+		}
+	})
+
+	t.Run("BatchAppendHistory applies every entry in one transaction", func(t *testing.T) {
+		batch := []HistoryEntry{
+			{Ticker: "INTC", Indicator: "occ", Signal: "buy", SignalStrength: 1},
+			{Ticker: "INTC", Indicator: "occ", Signal: "sell", SignalStrength: 2},
+		}
+		if err := s.BatchAppendHistory(ctx, batch); err != nil {
+			t.Fatalf("BatchAppendHistory failed: %v", err)
+		}
+
+		entries, _, err := s.ListHistory(ctx, HistoryFilter{Ticker: "INTC", Limit: 10})
+		if err != nil {
+			t.Fatalf("ListHistory failed: %v", err)
+		}
+		if len(entries) != len(batch) {
+			t.Fatalf("Expected %d history entries for INTC, got %d", len(batch), len(entries))
+		}
+	})
+
+	t.Run("AppendHistory and ListHistory", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			entry := HistoryEntry{Ticker: "TSLA", Indicator: "momentum", Signal: "buy", SignalStrength: i}
+			if err := s.AppendHistory(ctx, entry); err != nil {
+				t.Fatalf("AppendHistory failed: %v", err)
+			}
+		}
+
+		entries, nextCursor, err := s.ListHistory(ctx, HistoryFilter{Ticker: "TSLA", Limit: 2})
+		if err != nil {
+			t.Fatalf("ListHistory failed: %v", err)
+		}
+		if len(entries) != 2 {
+			t.Fatalf("Expected 2 entries on first page, got %d", len(entries))
+		}
+		if nextCursor == 0 {
+			t.Fatalf("Expected a non-zero cursor for a full page")
+		}
+
+		rest, nextCursor, err := s.ListHistory(ctx, HistoryFilter{Ticker: "TSLA", Limit: 2, Cursor: nextCursor})
+		if err != nil {
+			t.Fatalf("ListHistory (page 2) failed: %v", err)
+		}
+		if len(rest) != 1 {
+			t.Fatalf("Expected 1 entry on second page, got %d", len(rest))
+		}
+		if nextCursor != 0 {
+			t.Errorf("Expected cursor 0 once exhausted, got %d", nextCursor)
+		}
+	})
+
+	t.Run("HistoryStats grades holds against AnalystPriceTarget", func(t *testing.T) {
+		priceAt := func(v float64) *float64 { return &v }
+
+		entries := []HistoryEntry{
+			{Ticker: "NFLX", Indicator: "occ", Signal: "buy", AnalystPriceTarget: priceAt(100)},
+			{Ticker: "NFLX", Indicator: "occ", Signal: "sell", AnalystPriceTarget: priceAt(90)}, // closes the buy hold: price fell -> loss
+			{Ticker: "NFLX", Indicator: "occ", Signal: "buy", AnalystPriceTarget: priceAt(80)},  // closes the sell hold: price kept falling -> win
+		}
+		for _, e := range entries {
+			if err := s.AppendHistory(ctx, e); err != nil {
+				t.Fatalf("AppendHistory failed: %v", err)
+			}
+		}
+
+		stats, err := s.HistoryStats(ctx, "NFLX")
+		if err != nil {
+			t.Fatalf("HistoryStats failed: %v", err)
+		}
+		if len(stats) != 1 {
+			t.Fatalf("Expected stats for 1 indicator, got %+v", stats)
+		}
+		occ := stats[0]
+		if occ.Indicator != "occ" || occ.Wins != 1 || occ.Losses != 1 {
+			t.Errorf("Expected occ wins=1 losses=1, got %+v", occ)
+		}
+	})
+}
+
+func TestSQLiteStore(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "securities.db")
+	s, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open sqlite store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	runStoreSuite(t, s)
+}
+
+// TestNewRelativeSQLiteDSN asserts that a two-slash sqlite:// DSN with no
+// further leading slash (e.g. sqlite://securities.db) opens a file at that
+// relative path rather than a file literally named "sqlite://securities.db".
+func TestNewRelativeSQLiteDSN(t *testing.T) {
+	dir := t.TempDir()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to chdir to temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+
+	s, err := New("sqlite://securities.db")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	if _, err := os.Stat(filepath.Join(dir, "securities.db")); err != nil {
+		t.Errorf("Expected securities.db in %s, got: %v", dir, err)
+	}
+}
+
+// TestPostgresStore runs the same suite against a real PostgreSQL instance
+// when STORE_TEST_POSTGRES_URL is set (e.g. in CI), and is skipped
+// otherwise since no Postgres server is available locally by default.
+func TestPostgresStore(t *testing.T) {
+	databaseURL := os.Getenv("STORE_TEST_POSTGRES_URL")
+	if databaseURL == "" {
+		t.Skip("STORE_TEST_POSTGRES_URL not set, skipping PostgreSQL store tests")
+	}
+
+	s, err := New(databaseURL)
+	if err != nil {
+		t.Fatalf("Failed to open postgres store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	runStoreSuite(t, s)
+}
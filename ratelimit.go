@@ -0,0 +1,154 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWebhookIPQPS     = 5.0
+	defaultWebhookTickerQPS = 2.0
+)
+
+// tokenBucket is a simple token-bucket rate limiter: it holds up to
+// capacity tokens, refilled continuously at refillPerSec, and allow()
+// reports whether a token was available along with how long to wait for
+// one otherwise.
+type tokenBucket struct {
+	mu           sync.Mutex
+	tokens       float64
+	capacity     float64
+	refillPerSec float64
+	last         time.Time
+}
+
+func newTokenBucket(qps float64) *tokenBucket {
+	return &tokenBucket{tokens: qps, capacity: qps, refillPerSec: qps, last: time.Now()}
+}
+
+func (b *tokenBucket) allow() (ok bool, retryAfter time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.refillPerSec)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := (1 - b.tokens) / b.refillPerSec
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// keyedLimiter hands out one token bucket per key (source IP or ticker),
+// creating it lazily on first use. Buckets are never evicted; that's an
+// acceptable tradeoff for the cardinality of IPs and tickers this service
+// sees, but would need bounding if either grew unbounded.
+type keyedLimiter struct {
+	qps float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newKeyedLimiter(qps float64) *keyedLimiter {
+	return &keyedLimiter{qps: qps, buckets: make(map[string]*tokenBucket)}
+}
+
+func (k *keyedLimiter) allow(key string) (ok bool, retryAfter time.Duration) {
+	k.mu.Lock()
+	b, found := k.buckets[key]
+	if !found {
+		b = newTokenBucket(k.qps)
+		k.buckets[key] = b
+	}
+	k.mu.Unlock()
+	return b.allow()
+}
+
+// clientIP extracts the caller's address for rate limiting purposes. When
+// trustProxyHeaders is true it prefers the first hop of a proxy-set
+// X-Forwarded-For header over RemoteAddr; otherwise X-Forwarded-For is
+// ignored, since trusting it unconditionally lets any caller pick a fresh
+// IP on every request and bypass the per-IP limiter entirely. Only set
+// trustProxyHeaders when this service sits behind a reverse proxy that
+// overwrites (rather than appends to) that header.
+func clientIP(r *http.Request, trustProxyHeaders bool) string {
+	if trustProxyHeaders {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			if i := strings.IndexByte(fwd, ','); i >= 0 {
+				fwd = fwd[:i]
+			}
+			return strings.TrimSpace(fwd)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// withWebhookRateLimit enforces a configurable per-IP QPS around /webhook
+// with a token-bucket limiter, returning 429 with a Retry-After header when
+// it's exceeded. It keys on X-Forwarded-For instead of RemoteAddr only when
+// trustProxyHeaders is true (see clientIP). The per-ticker limit lives in
+// handleWebhook instead of here: the ticker comes from the request body,
+// which is only trustworthy once verifyWebhookSignature has passed, so
+// rate-limiting on it pre-auth would let an unauthenticated caller drain a
+// ticker's bucket and get legitimately signed alerts for it rejected.
+func withWebhookRateLimit(ipQPS float64, trustProxyHeaders bool) func(http.HandlerFunc) http.HandlerFunc {
+	ipLimiter := newKeyedLimiter(ipQPS)
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if ok, retryAfter := ipLimiter.allow(clientIP(r, trustProxyHeaders)); !ok {
+				tooManyRequests(w, retryAfter)
+				return
+			}
+
+			next(w, r)
+		}
+	}
+}
+
+// tooManyRequests writes a 429 response with a Retry-After header rounded
+// up to the nearest whole second.
+func tooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+}
+
+// trustProxyHeadersFromEnv reads TRUST_PROXY_HEADERS, defaulting to false
+// (RemoteAddr only) so a reverse proxy must be explicitly configured
+// before X-Forwarded-For is trusted for rate limiting.
+func trustProxyHeadersFromEnv() bool {
+	trust, err := strconv.ParseBool(os.Getenv("TRUST_PROXY_HEADERS"))
+	return err == nil && trust
+}
+
+// qpsFromEnv reads a QPS setting from the named environment variable,
+// falling back to def if it's unset or not a positive number.
+func qpsFromEnv(name string, def float64) float64 {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	qps, err := strconv.ParseFloat(raw, 64)
+	if err != nil || qps <= 0 {
+		return def
+	}
+	return qps
+}
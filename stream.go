@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/tombryson/TradingViewAPI_serivce/pkg/signals"
+	"github.com/tombryson/TradingViewAPI_serivce/pkg/store"
+)
+
+// streamChannel identifies a class of events a /stream client can subscribe to.
+type streamChannel string
+
+const (
+	channelSignals      streamChannel = "signals"
+	channelPriceTargets streamChannel = "price_targets"
+	channelVWMA         streamChannel = "vwma"
+	channelComposite    streamChannel = "composite"
+)
+
+const (
+	// subscriberBufferSize bounds how many undelivered events a subscriber
+	// can queue before it's treated as a slow consumer and disconnected.
+	subscriberBufferSize = 64
+	streamPingInterval   = 30 * time.Second
+	streamWriteWait      = 10 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// streamEvent is a single message pushed to subscribers of a channel.
+type streamEvent struct {
+	Type    string        `json:"type"` // "snapshot" or "update"
+	Channel streamChannel `json:"channel"`
+	Ticker  string        `json:"ticker"`
+	Data    interface{}   `json:"data"`
+}
+
+// subscribeRequest is a client->server control message sent over the
+// WebSocket to (un)subscribe to a channel, optionally filtered to a set of
+// tickers. An empty Tickers list means "all tickers".
+type subscribeRequest struct {
+	Action  string   `json:"action"` // "subscribe" or "unsubscribe"
+	Channel string   `json:"channel"`
+	Tickers []string `json:"tickers,omitempty"`
+}
+
+// subscriber is one connected /stream client and the set of channel/ticker
+// filters it has asked to receive.
+type subscriber struct {
+	conn *websocket.Conn
+	send chan streamEvent
+
+	mu       sync.Mutex
+	channels map[streamChannel]map[string]bool // channel -> tickers ("" means all)
+}
+
+func newSubscriber(conn *websocket.Conn) *subscriber {
+	return &subscriber{
+		conn:     conn,
+		send:     make(chan streamEvent, subscriberBufferSize),
+		channels: make(map[streamChannel]map[string]bool),
+	}
+}
+
+func (s *subscriber) subscribe(channel streamChannel, tickers []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tickerSet, ok := s.channels[channel]
+	if !ok {
+		tickerSet = make(map[string]bool)
+		s.channels[channel] = tickerSet
+	}
+	if len(tickers) == 0 {
+		tickerSet[""] = true
+		return
+	}
+	for _, t := range tickers {
+		tickerSet[t] = true
+	}
+}
+
+func (s *subscriber) unsubscribe(channel streamChannel, tickers []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tickerSet, ok := s.channels[channel]
+	if !ok {
+		return
+	}
+	if len(tickers) == 0 {
+		delete(s.channels, channel)
+		return
+	}
+	for _, t := range tickers {
+		delete(tickerSet, t)
+	}
+}
+
+// wants reports whether this subscriber should receive the given event based
+// on its current channel/ticker filters.
+func (s *subscriber) wants(event streamEvent) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tickerSet, ok := s.channels[event.Channel]
+	if !ok {
+		return false
+	}
+	return tickerSet[""] || tickerSet[event.Ticker]
+}
+
+// broker fans out published events to every subscriber whose filters match,
+// disconnecting any subscriber whose send buffer is full instead of
+// blocking the publisher on a slow consumer.
+type broker struct {
+	mu          sync.RWMutex
+	subscribers map[*subscriber]bool
+}
+
+func newBroker() *broker {
+	return &broker{subscribers: make(map[*subscriber]bool)}
+}
+
+func (b *broker) register(s *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[s] = true
+}
+
+func (b *broker) unregister(s *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[s]; ok {
+		delete(b.subscribers, s)
+		close(s.send)
+	}
+}
+
+func (b *broker) publish(event streamEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for s := range b.subscribers {
+		if !s.wants(event) {
+			continue
+		}
+		select {
+		case s.send <- event:
+		default:
+			slog.Warn("stream subscriber buffer full, disconnecting slow consumer", "channel", event.Channel, "ticker", event.Ticker)
+			go s.conn.Close()
+		}
+	}
+}
+
+// handleStream upgrades the connection to a WebSocket and streams signal,
+// price-target and VWMA updates to the client as handleWebhook processes
+// new alerts. Clients drive subscriptions with subscribeRequest messages;
+// subscribing sends a snapshot of current state for the matching tickers
+// before any live updates.
+func handleStream(s store.Store, b *broker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			slog.Error("websocket upgrade failed", "error", err)
+			return
+		}
+
+		sub := newSubscriber(conn)
+		b.register(sub)
+
+		done := make(chan struct{})
+		go sub.writePump(done)
+		sub.readPump(s, b)
+
+		close(done)
+		b.unregister(sub)
+		conn.Close()
+	}
+}
+
+// writePump delivers queued events and periodic pings to the client until
+// the subscriber is unregistered or the connection breaks.
+func (s *subscriber) writePump(done <-chan struct{}) {
+	ticker := time.NewTicker(streamPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-s.send:
+			s.conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if !ok {
+				s.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := s.conn.WriteJSON(event); err != nil {
+				slog.Warn("error writing to stream subscriber", "channel", event.Channel, "ticker", event.Ticker, "error", err)
+				return
+			}
+		case <-ticker.C:
+			s.conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if err := s.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// readPump handles subscribe/unsubscribe control messages from the client
+// for as long as the connection stays open.
+func (s *subscriber) readPump(st store.Store, b *broker) {
+	for {
+		var req subscribeRequest
+		if err := s.conn.ReadJSON(&req); err != nil {
+			return
+		}
+
+		channel := streamChannel(req.Channel)
+		switch req.Action {
+		case "subscribe":
+			s.subscribe(channel, req.Tickers)
+			s.sendSnapshot(st, channel, req.Tickers)
+		case "unsubscribe":
+			s.unsubscribe(channel, req.Tickers)
+		default:
+			slog.Warn("unknown stream action", "action", req.Action)
+		}
+	}
+}
+
+// sendSnapshot pushes the current database state for the given channel,
+// filtered to tickers if non-empty, so a newly subscribed client doesn't
+// have to wait for the next alert to learn the current state.
+func (s *subscriber) sendSnapshot(st store.Store, channel streamChannel, tickers []string) {
+	securities, err := st.ListSecurities(context.Background())
+	if err != nil {
+		slog.Error("error querying database for stream snapshot", "channel", channel, "error", err)
+		return
+	}
+
+	wanted := make(map[string]bool, len(tickers))
+	for _, t := range tickers {
+		wanted[t] = true
+	}
+
+	for _, sec := range securities {
+		if len(wanted) > 0 && !wanted[sec.Ticker] {
+			continue
+		}
+
+		data := map[string]interface{}{
+			"ticker":          sec.Ticker,
+			"signal":          sec.Signal,
+			"signalStrength":  sec.SignalStrength,
+			"vwmaPosition":    sec.VWMAPosition,
+			"compositeSignal": sec.CompositeSignal,
+		}
+		if sec.AnalystPriceTarget != nil {
+			data["analyst_price_target"] = *sec.AnalystPriceTarget
+		}
+
+		event := streamEvent{Type: "snapshot", Channel: channel, Ticker: sec.Ticker, Data: data}
+		select {
+		case s.send <- event:
+		default:
+			slog.Warn("stream subscriber buffer full during snapshot, disconnecting slow consumer", "channel", channel, "ticker", sec.Ticker)
+			go s.conn.Close()
+			return
+		}
+	}
+}
+
+// publishAlert fans out the channel(s) affected by a processed alert to
+// every matching /stream subscriber.
+func publishAlert(b *broker, alert TradingViewAlert) {
+	data, err := json.Marshal(alert)
+	if err != nil {
+		slog.Error("error marshaling alert for stream", "ticker", alert.Ticker, "error", err)
+		return
+	}
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		slog.Error("error unmarshaling alert for stream", "ticker", alert.Ticker, "error", err)
+		return
+	}
+
+	b.publish(streamEvent{Type: "update", Channel: channelSignals, Ticker: alert.Ticker, Data: raw})
+	b.publish(streamEvent{Type: "update", Channel: channelVWMA, Ticker: alert.Ticker, Data: raw})
+	if alert.Event == "price_target_change" {
+		b.publish(streamEvent{Type: "update", Channel: channelPriceTargets, Ticker: alert.Ticker, Data: raw})
+	}
+}
+
+// publishComposite fans out a newly computed composite decision to every
+// matching /stream subscriber of the composite channel.
+func publishComposite(b *broker, decision signals.Decision) {
+	data := map[string]interface{}{
+		"ticker":          decision.Ticker,
+		"compositeSignal": decision.Signal,
+		"score":           decision.Score,
+	}
+	b.publish(streamEvent{Type: "update", Channel: channelComposite, Ticker: decision.Ticker, Data: data})
+}